@@ -0,0 +1,1142 @@
+// yuzuchat - YuzuChat Multi-Provider AI Client
+// ©2025 hkkm project | built with love 💕
+// guthib.com/icedeyes12
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/yuzu"
+)
+
+// readLines delivers lines from r on a channel, closing it at EOF.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+func clearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
+
+// describeError renders an error from the yuzu package for the REPL, with
+// a hint on what to do about it where there is one.
+func describeError(err error) string {
+	var providerErr *yuzu.ProviderError
+	errors.As(err, &providerErr)
+	var certErr *tls.CertificateVerificationError
+	switch {
+	case errors.Is(err, yuzu.ErrAuth):
+		return fmt.Sprintf("🔑 %v\n   Check keys with /keys check or set a new one with /key <provider> <api_key>", err)
+	case errors.Is(err, yuzu.ErrRateLimited):
+		if providerErr != nil && providerErr.RetryAfter > 0 {
+			return fmt.Sprintf("⏳ %v\n   Try again in %s or switch with /provider", err, providerErr.RetryAfter)
+		}
+		return fmt.Sprintf("⏳ %v\n   Wait a moment or switch with /provider", err)
+	case errors.Is(err, yuzu.ErrQuotaExceeded):
+		return fmt.Sprintf("💸 %v", err)
+	case errors.Is(err, yuzu.ErrContextLength):
+		return fmt.Sprintf("📏 %v\n   Shorten the conversation with /undo, /delete or /clearhistory", err)
+	case errors.Is(err, yuzu.ErrProviderUnavailable):
+		return fmt.Sprintf("🚧 %v\n   Try another provider with /provider", err)
+	case errors.Is(err, yuzu.ErrTimeout):
+		return fmt.Sprintf("⌛ %v\n   If the model is just slow, raise the limit under \"providers\" in profile.json", err)
+	case errors.As(err, &certErr):
+		return fmt.Sprintf("🔒 %v\n   Behind a TLS-inspecting proxy? Set \"ca_bundle\" under \"network\" in profile.json", err)
+	case errors.Is(err, yuzu.ErrNetwork), errors.Is(err, yuzu.ErrParse):
+		return fmt.Sprintf("💥 %v", err)
+	case errors.Is(err, yuzu.ErrInUse):
+		return fmt.Sprintf("🔒 %v\n   Quit the other yuzuchat, or run this one from another directory", err)
+	case errors.Is(err, yuzu.ErrStorage):
+		return fmt.Sprintf("💾 %v\n   Check free disk space and permissions in this directory", err)
+	case errors.Is(err, yuzu.ErrNotFound):
+		return fmt.Sprintf("❌ %v. Use /providers, /models, /persona list or /history to see what exists.", err)
+	}
+	return fmt.Sprintf("❌ %v", err)
+}
+
+// Exit codes of one-shot mode.
+const (
+	exitError         = 1
+	exitUsage         = 2
+	exitAuth          = 3
+	exitRateLimited   = 4
+	exitQuota         = 5
+	exitContextLength = 6
+	exitUnavailable   = 7
+	exitInvalidReply  = 8
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, yuzu.ErrAuth):
+		return exitAuth
+	case errors.Is(err, yuzu.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, yuzu.ErrQuotaExceeded):
+		return exitQuota
+	case errors.Is(err, yuzu.ErrContextLength):
+		return exitContextLength
+	case errors.Is(err, yuzu.ErrProviderUnavailable), errors.Is(err, yuzu.ErrNetwork), errors.Is(err, yuzu.ErrTimeout):
+		return exitUnavailable
+	case errors.Is(err, yuzu.ErrInvalidReply), errors.Is(err, yuzu.ErrParse):
+		return exitInvalidReply
+	}
+	return exitError
+}
+
+// finishWarning explains a reply that did not end normally, or returns ""
+// when it did.
+func finishWarning(reason string, continuations int) string {
+	switch reason {
+	case "", "stop":
+		return ""
+	case "length":
+		if continuations == 1 {
+			return "✂️ Reply cut off at the token limit after 1 continuation"
+		} else if continuations > 1 {
+			return fmt.Sprintf("✂️ Reply cut off at the token limit after %d continuations", continuations)
+		}
+		return "✂️ Reply cut off at the token limit"
+	case "content_filter":
+		return "🚫 Reply stopped by the provider's content filter"
+	}
+	return "⚠️ Reply ended early: " + reason
+}
+
+// promptSize describes the length of a prompt.
+func promptSize(prompt string) string {
+	if prompt == "" {
+		return "empty"
+	}
+	return fmt.Sprintf("%d lines, %d characters", strings.Count(prompt, "\n")+1, len(prompt))
+}
+
+// showSystemPrompt prints the system prompt, and the persona prompt that
+// replaces it if one is active.
+func showSystemPrompt(chat *yuzu.YuzuChat, expanded bool) {
+	const rule = "────────────────────────────────────────\n"
+	if prompt := chat.PersonaPrompt(expanded); prompt != "" {
+		colorPrint(yellow, "🎭 Persona '%s' is active; its prompt replaces system.txt:\n", chat.PersonaName())
+		fmt.Println(prompt)
+		colorPrint(yellow, rule)
+	}
+	prompt := chat.SystemPrompt(expanded)
+	if prompt == "" {
+		fmt.Println("No system prompt set (system.txt is empty or doesn't exist)")
+		return
+	}
+	colorPrint(cyan, "📋 Current system prompt (%s):\n", promptSize(prompt))
+	colorPrint(cyan, rule)
+	fmt.Println(prompt)
+	colorPrint(cyan, rule)
+}
+
+// printReply runs send, which asks for a reply, and shows it: streamed as it
+// arrives, or with a progress line and token stats followed by the answer.
+func printReply(chat *yuzu.YuzuChat, streaming bool, send func(onDelta func(string)) (yuzu.Response, error)) {
+	if streaming {
+		started := false
+		response, err := send(func(delta string) {
+			if !started {
+				colorPrint(cyan, "🤖: ")
+				started = true
+			}
+			fmt.Print(delta)
+		})
+		if started {
+			fmt.Println()
+		}
+		if err != nil && !errors.Is(err, yuzu.ErrStorage) {
+			colorPrint(red, "%s\n", describeError(err))
+			return
+		}
+		responseTime := response.Duration.Seconds()
+		throughput := float64(response.Usage.CompletionTokens) / responseTime
+		if response.Estimated {
+			fmt.Printf("⏱️ %.2fs | 🚀 ~%.0f t/s (estimated)\n", responseTime, throughput)
+		} else {
+			fmt.Printf("⏱️ %.2fs | 📨 %d→%d tokens | 🚀 %.0f t/s\n",
+				responseTime, response.Usage.PromptTokens, response.Usage.CompletionTokens, throughput)
+		}
+		if warning := finishWarning(response.FinishReason, response.Continuations); warning != "" {
+			colorPrint(yellow, "%s\n", warning)
+		}
+		if err != nil {
+			colorPrint(red, "%s\n", describeError(err))
+		}
+		return
+	}
+	fmt.Printf("🔧 Using: %s/%s...\r", chat.CurrentProvider(), chat.CurrentModel())
+	response, err := send(nil)
+	if err != nil && !errors.Is(err, yuzu.ErrStorage) {
+		colorPrint(red, "%s\n", describeError(err))
+		return
+	}
+	responseTime := response.Duration.Seconds()
+	throughput := float64(response.Usage.CompletionTokens) / responseTime
+	fmt.Printf("⏱️ %.2fs | 📨 %d→%d tokens | 🚀 %.0f t/s\n",
+		responseTime, response.Usage.PromptTokens, response.Usage.CompletionTokens, throughput)
+	colorPrint(green, "AI: %s\n", response.Content)
+	if warning := finishWarning(response.FinishReason, response.Continuations); warning != "" {
+		colorPrint(yellow, "%s\n", warning)
+	}
+	if err != nil {
+		colorPrint(red, "%s\n", describeError(err))
+	}
+}
+
+// configureClient applies the --record, --replay, --debug and --log-level
+// flags.
+func configureClient(chat *yuzu.YuzuChat, recordDir, replayDir string, debug bool, debugFile, logLevel string) error {
+	if logLevel != "" {
+		if err := chat.SetLogLevel(logLevel); err != nil {
+			return err
+		}
+	}
+	if err := useCassette(chat, recordDir, replayDir); err != nil {
+		return err
+	}
+	return setDebug(chat, debug, debugFile)
+}
+
+// formatLogLine renders a JSON log record as time, level and message
+// followed by its other attributes in name order.
+func formatLogLine(line string) string {
+	var record map[string]interface{}
+	if json.Unmarshal([]byte(line), &record) != nil {
+		return line
+	}
+	timestamp, _ := record["time"].(string)
+	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		timestamp = t.Format("01-02 15:04:05")
+	}
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s %-5v %v", timestamp, record["level"], record["msg"])
+	delete(record, "time")
+	delete(record, "level")
+	delete(record, "msg")
+	names := make([]string, 0, len(record))
+	for name := range record {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%v", name, record[name])
+	}
+	return b.String()
+}
+
+// debugLog is the rotating file debug output goes to, if any.
+var debugLog io.Closer
+
+// setDebug turns traffic logging on, to path or stderr, or off.
+func setDebug(chat *yuzu.YuzuChat, on bool, path string) error {
+	if debugLog != nil {
+		debugLog.Close()
+		debugLog = nil
+	}
+	switch {
+	case !on:
+		chat.SetDebug(nil)
+	case path == "":
+		chat.SetDebug(os.Stderr)
+	default:
+		log, err := yuzu.OpenRotatingLog(path)
+		if err != nil {
+			return fmt.Errorf("opening debug log: %w", err)
+		}
+		debugLog = log
+		chat.SetDebug(log)
+	}
+	return nil
+}
+
+// useCassette applies --record or --replay.
+func useCassette(chat *yuzu.YuzuChat, recordDir, replayDir string) error {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return errors.New("--record and --replay cannot be used together")
+	case recordDir != "":
+		if err := chat.Record(recordDir); err != nil {
+			return fmt.Errorf("recording to %s: %w", recordDir, err)
+		}
+		colorPrint(yellow, "📼 Recording provider traffic to %s (API keys are redacted)\n", recordDir)
+	case replayDir != "":
+		if err := chat.Replay(replayDir); err != nil {
+			return fmt.Errorf("replaying %s: %w", replayDir, err)
+		}
+		colorPrint(yellow, "📼 Replaying provider traffic from %s\n", replayDir)
+	}
+	return nil
+}
+
+// runOneShot answers a single prompt taken from the arguments, or stdin when
+// there are none, printing only the reply on stdout. It returns the exit code.
+func runOneShot(chat *yuzu.YuzuChat, prompt, schemaFile string, jsonOutput bool, retries int) int {
+	if prompt == "" || prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			colorPrint(red, "❌ Error reading prompt: %v\n", err)
+			return exitError
+		}
+		prompt = strings.TrimSpace(string(data))
+	}
+	if prompt == "" {
+		colorPrint(red, "❌ No prompt given\n")
+		return exitUsage
+	}
+	if schemaFile != "" {
+		schema, err := yuzu.LoadResponseSchema(schemaFile)
+		if err != nil {
+			colorPrint(red, "❌ Invalid schema: %v\n", err)
+			return exitUsage
+		}
+		chat.SetSchema(schema)
+	}
+	chat.SetJSONMode(jsonOutput)
+	chat.SetJSONRetries(retries)
+	expanded, err := yuzu.ExpandInlineTemplates(prompt)
+	if err != nil {
+		colorPrint(red, "Template error: %v\n", err)
+		return exitUsage
+	}
+	response, err := chat.AskOnce(context.Background(), expanded)
+	if err != nil && !errors.Is(err, yuzu.ErrStorage) {
+		colorPrint(red, "%s\n", describeError(err))
+		return exitCode(err)
+	}
+	fmt.Println(response.Content)
+	if warning := finishWarning(response.FinishReason, response.Continuations); warning != "" {
+		colorPrint(yellow, "%s\n", warning)
+	}
+	if err != nil {
+		colorPrint(red, "%s\n", describeError(err))
+		return exitCode(err)
+	}
+	return 0
+}
+
+func main() {
+	schemaFile := flag.String("schema", "", "JSON Schema file the one-shot reply must match")
+	jsonOutput := flag.Bool("json", false, "require the one-shot reply to be valid JSON")
+	retries := flag.Int("retries", yuzu.DefaultJSONRetries, "times to re-prompt when a JSON reply fails validation")
+	recordDir := flag.String("record", "", "save provider requests and responses to this cassette directory")
+	replayDir := flag.String("replay", "", "answer provider requests from this cassette directory, offline")
+	debug := flag.Bool("debug", false, "log raw provider requests and responses to stderr")
+	debugFile := flag.String("debug-file", "", "log raw provider traffic to this rotating file instead of stderr")
+	logLevel := flag.String("log-level", "", "least severe level written to yuzuchat.log: debug, info, warn or error")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: yuzuchat [flags] [prompt]   (no prompt: interactive chat, - : prompt from stdin)\n")
+		fmt.Fprintf(os.Stderr, "       yuzuchat serve [--addr host:port]\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 && flag.Arg(0) == "serve" {
+		serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := serveFlags.String("addr", "127.0.0.1:8080", "address to listen on")
+		serveFlags.Parse(flag.Args()[1:])
+		chat, err := yuzu.New("chat_history.json", "profile.json", "system.txt")
+		if err != nil {
+			colorPrint(red, "%s\n", describeError(err))
+			os.Exit(exitError)
+		}
+		if err := configureClient(chat, *recordDir, *replayDir, *debug || *debugFile != "", *debugFile, *logLevel); err != nil {
+			colorPrint(red, "❌ %v\n", err)
+			chat.Close()
+			os.Exit(exitUsage)
+		}
+		showStartup(chat)
+		colorPrint(green, "🌐 Serving OpenAI-compatible API on http://%s/v1\n", *addr)
+		err = chat.Serve(*addr)
+		chat.Close()
+		colorPrint(red, "❌ Server stopped: %v\n", err)
+		os.Exit(1)
+	}
+	oneShot := flag.NArg() > 0 || *schemaFile != "" || *jsonOutput
+	if oneShot {
+		statusOutput = os.Stderr
+	}
+	chat, err := yuzu.New("chat_history.json", "profile.json", "system.txt")
+	if err != nil {
+		colorPrint(red, "%s\n", describeError(err))
+		os.Exit(exitError)
+	}
+	if err := configureClient(chat, *recordDir, *replayDir, *debug || *debugFile != "", *debugFile, *logLevel); err != nil {
+		colorPrint(red, "❌ %v\n", err)
+		chat.Close()
+		os.Exit(exitUsage)
+	}
+	showStartup(chat)
+	if oneShot {
+		code := runOneShot(chat, strings.Join(flag.Args(), " "), *schemaFile, *jsonOutput, *retries)
+		chat.Close()
+		os.Exit(code)
+	}
+	defer chat.Close()
+	colorPrint(purple, `
+🍊Yuzu Prototype - HKMM Project♨️
+================================
+https://guthib.com/icedeyes12/
+
+Tips: Type /? for help, /info for status
+
+Special commands:
+  /?              - show help
+  /info           - show current status  
+  /key <provider> <api_key> - set API key
+  /exit           - quit
+	`)
+	runREPL(chat, os.Stdin)
+}
+
+// runREPL reads commands and messages from in until /exit or EOF.
+func runREPL(chat *yuzu.YuzuChat, in io.Reader) {
+	ctx := context.Background()
+	inputs := readLines(in)
+	changes, stopWatching := chat.WatchConfigFiles()
+	defer stopWatching()
+	streaming := false
+	for {
+		colorPrint(cyan, "\nYou: ")
+		line, ok := "", false
+		for waiting := true; waiting; {
+			select {
+			case line, ok = <-inputs:
+				waiting = false
+			case path := <-changes:
+				reload, err := chat.ReloadChangedFile(path)
+				if err != nil {
+					colorPrint(red, "\n⚠️ %v\n", err)
+					colorPrint(cyan, "You: ")
+				} else if notice := describeReload(chat, reload); notice != "" {
+					colorPrint(yellow, "\n%s\n", notice)
+					colorPrint(cyan, "You: ")
+				}
+			}
+		}
+		if !ok {
+			break
+		}
+		userInput := strings.TrimSpace(line)
+		if userInput == "" {
+			continue
+		}
+		if strings.HasPrefix(userInput, "/") {
+			parts := strings.Fields(userInput[1:])
+			if len(parts) == 0 {
+				continue
+			}
+			command := strings.ToLower(parts[0])
+			args := parts[1:]
+			switch command {
+			case "exit", "quit", "bye":
+				colorPrint(green, "Mata ne~! (Goodbye!)\n")
+				return
+			case "key":
+				if len(args) >= 2 {
+					provider := args[0]
+					apiKey := strings.Join(args[1:], " ")
+					check, err := chat.SetAPIKey(provider, apiKey)
+					if check.Provider != "" {
+						colorPrint(cyan, "%s\n", describeKeyCheck(check))
+					}
+					if err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ %s API key saved\n", provider)
+					}
+				} else {
+					colorPrint(yellow, "Usage: /key <provider> <api_key>\n")
+					colorPrint(yellow, "Providers: chutes, openrouter, cerebras\n")
+				}
+				continue
+			case "keys":
+				if len(args) >= 1 && args[0] == "check" {
+					checks := chat.CheckAPIKeys()
+					if len(checks) == 0 {
+						colorPrint(yellow, "No API keys configured\n")
+					}
+					for _, check := range checks {
+						colorPrint(cyan, "%s\n", describeKeyCheck(check))
+					}
+				} else if len(args) >= 2 && args[0] == "startup" && (args[1] == "on" || args[1] == "off") {
+					if err := chat.SetKeyCheckOnStartup(args[1] == "on"); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Key check on startup: %s\n", strings.ToUpper(args[1]))
+					}
+				} else {
+					colorPrint(yellow, "Usage: /keys check | /keys startup on|off\n")
+				}
+				continue
+			case "export":
+				if len(args) < 2 {
+					colorPrint(yellow, "Usage: /export <md|html|jsonl|txt> <path> [from YYYY-MM-DD] [to YYYY-MM-DD]\n")
+					continue
+				}
+				var from, to time.Time
+				var err error
+				if len(args) >= 3 {
+					if from, err = yuzu.ParseDateArg(args[2]); err != nil {
+						colorPrint(red, "Invalid from date '%s'\n", args[2])
+						continue
+					}
+				}
+				if len(args) >= 4 {
+					if to, err = yuzu.ParseDateArg(args[3]); err != nil {
+						colorPrint(red, "Invalid to date '%s'\n", args[3])
+						continue
+					}
+					if len(args[3]) == len("2006-01-02") {
+						to = to.AddDate(0, 0, 1)
+					}
+				}
+				if count, err := chat.ExportHistory(args[0], args[1], from, to); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Exported %d messages to %s\n", count, args[1])
+				}
+				continue
+			case "import":
+				if len(args) < 2 {
+					colorPrint(yellow, "Usage: /import <chatgpt|jsonl|sillytavern> <path> [--new] [title|record]\n")
+					continue
+				}
+				newSession := false
+				var selector []string
+				for _, arg := range args[2:] {
+					if arg == "--new" {
+						newSession = true
+					} else {
+						selector = append(selector, arg)
+					}
+				}
+				if count, err := chat.ImportHistory(args[0], args[1], newSession, strings.Join(selector, " ")); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Imported %d messages from %s\n", count, args[1])
+				}
+				continue
+			case "search":
+				searchArgs := yuzu.SplitArgs(strings.TrimSpace(userInput[len("/search"):]))
+				if len(searchArgs) == 2 && (searchArgs[0] == "open" || searchArgs[0] == "fork") {
+					var n int
+					if _, err := fmt.Sscanf(searchArgs[1], "%d", &n); err != nil {
+						colorPrint(red, "Invalid result number '%s'\n", searchArgs[1])
+						continue
+					}
+					fork := searchArgs[0] == "fork"
+					count, err := chat.OpenSearchResult(n, fork)
+					switch {
+					case err != nil:
+						colorPrint(red, "%s\n", describeError(err))
+					case fork:
+						colorPrint(green, "✅ Forked %d messages into new session %s\n", count, chat.SessionID())
+					default:
+						colorPrint(green, "✅ Switched to session %s (%d messages)\n", chat.SessionID(), count)
+					}
+					continue
+				}
+				if len(searchArgs) == 0 {
+					colorPrint(yellow, "Usage: /search <query> [--regex] [--role r] [--model m] [--provider p] [--from date] [--to date]\n")
+					colorPrint(yellow, "       /search open <n> | /search fork <n>\n")
+					continue
+				}
+				query, err := yuzu.ParseSearchArgs(searchArgs)
+				if err != nil {
+					colorPrint(red, "Invalid search: %v\n", err)
+					continue
+				}
+				hits, err := chat.Search(query)
+				if err != nil {
+					colorPrint(red, "Search failed: %v\n", err)
+					continue
+				}
+				if len(hits) == 0 {
+					colorPrint(yellow, "No matches\n")
+					continue
+				}
+				for i, hit := range hits {
+					msg := hit.Message
+					colorPrint(cyan, "[%d] %s %s %s/%s (session %s)\n", i+1, msg.Timestamp, msg.Role, msg.Provider, msg.Model, msg.Session)
+					fmt.Printf("    %s\n", highlightSnippet(msg.Content, query.Patterns[0]))
+				}
+				colorPrint(yellow, "Use /search open <n> to jump into a conversation or /search fork <n> to branch from it\n")
+				continue
+			case "edit":
+				var n int
+				if len(args) < 2 {
+					colorPrint(yellow, "Usage: /edit <n> <new message>\n")
+					continue
+				}
+				if _, err := fmt.Sscanf(args[0], "%d", &n); err != nil {
+					colorPrint(red, "Invalid message number '%s'\n", args[0])
+					continue
+				}
+				text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(userInput[len("/edit"):]), args[0]))
+				colorPrint(yellow, "Thinking with %s/%s...\n", chat.CurrentProvider(), chat.CurrentModel())
+				printReply(chat, streaming, func(onDelta func(string)) (yuzu.Response, error) {
+					return chat.EditMessage(ctx, n, text, onDelta)
+				})
+				continue
+			case "regen":
+				colorPrint(yellow, "Thinking with %s/%s...\n", chat.CurrentProvider(), chat.CurrentModel())
+				printReply(chat, streaming, func(onDelta func(string)) (yuzu.Response, error) {
+					return chat.Regenerate(ctx, onDelta)
+				})
+				continue
+			case "branches":
+				branches, err := chat.Branches()
+				if err != nil {
+					colorPrint(red, "Failed to load branches: %v\n", err)
+					continue
+				}
+				if len(branches) == 0 {
+					colorPrint(yellow, "No branches in this session yet\n")
+					continue
+				}
+				colorPrint(cyan, "Branches in session %s:\n", chat.SessionID())
+				for i, branch := range branches {
+					leaf := branch.Path[len(branch.Path)-1]
+					from := branch.Diverge
+					if from >= len(branch.Path) {
+						from = len(branch.Path) - 1
+					}
+					preview := strings.Join(strings.Fields(branch.Path[from].Content), " ")
+					if len(preview) > 60 {
+						preview = preview[:60] + "…"
+					}
+					line := fmt.Sprintf("  [%d] %d msgs, %s, from #%d: %s", i+1, len(branch.Path), leaf.Timestamp, from+1, preview)
+					if branch.Current {
+						colorPrint(yellow, "%s <- CURRENT\n", line)
+					} else {
+						fmt.Println(line)
+					}
+				}
+				continue
+			case "checkout":
+				var n int
+				if len(args) < 1 {
+					colorPrint(yellow, "Usage: /checkout <branch number>\n")
+					continue
+				}
+				if _, err := fmt.Sscanf(args[0], "%d", &n); err != nil {
+					colorPrint(red, "Invalid branch number '%s'\n", args[0])
+					continue
+				}
+				if count, err := chat.Checkout(n); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Switched to branch %d (%d messages)\n", n, count)
+				}
+				continue
+			case "history":
+				if len(chat.History()) == 0 {
+					colorPrint(yellow, "No messages in this conversation\n")
+					continue
+				}
+				for i, msg := range chat.History() {
+					preview := strings.Join(strings.Fields(msg.Content), " ")
+					if len(preview) > 60 {
+						preview = preview[:60] + "…"
+					}
+					colorPrint(cyan, "  #%d %s %s %s/%s\n", i+1, msg.Timestamp, msg.Role, msg.Provider, msg.Model)
+					fmt.Printf("      %s\n", preview)
+				}
+				continue
+			case "attach":
+				if len(args) < 1 {
+					colorPrint(yellow, "Usage: /attach <path>\n")
+					continue
+				}
+				path := strings.TrimSpace(userInput[len("/attach"):])
+				if attachment, err := chat.Attach(path); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Attached %s (%s, %d bytes) to session %s\n", attachment.Name, attachment.MimeType, len(attachment.Data), chat.SessionID())
+				}
+				continue
+			case "attachments":
+				attachments, err := chat.Attachments()
+				if err != nil {
+					colorPrint(red, "Failed to load attachments: %v\n", err)
+					continue
+				}
+				if len(attachments) == 0 {
+					colorPrint(yellow, "No attachments in this session\n")
+					continue
+				}
+				colorPrint(cyan, "Attachments in session %s:\n", chat.SessionID())
+				for _, attachment := range attachments {
+					fmt.Printf("  - %s (%s, %d bytes) %s\n", attachment.Name, attachment.MimeType, len(attachment.Data), attachment.CreatedAt)
+				}
+				continue
+			case "undo":
+				if count, err := chat.Undo(); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Removed last %d messages\n", count)
+				}
+				continue
+			case "retry":
+				colorPrint(yellow, "Retrying last message...\n")
+				printReply(chat, streaming, func(onDelta func(string)) (yuzu.Response, error) {
+					return chat.Retry(ctx, strings.Join(args, " "), onDelta)
+				})
+				continue
+			case "delete":
+				var n int
+				if len(args) < 1 {
+					colorPrint(yellow, "Usage: /delete <n>\n")
+					continue
+				}
+				if _, err := fmt.Sscanf(args[0], "%d", &n); err != nil {
+					colorPrint(red, "Invalid message number '%s'\n", args[0])
+					continue
+				}
+				if err := chat.DeleteMessage(n); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Deleted message #%d\n", n)
+				}
+				continue
+			case "compare":
+				var targets [][2]string
+				var invalid error
+				i := 0
+				for ; i < len(args); i++ {
+					name, _, _ := strings.Cut(args[i], "/")
+					if _, exists := chat.Provider(strings.ToLower(name)); !exists || !strings.Contains(args[i], "/") {
+						break
+					}
+					providerName, model, err := chat.ParseCompareTarget(args[i])
+					if err != nil {
+						invalid = err
+						break
+					}
+					targets = append(targets, [2]string{providerName, model})
+				}
+				if invalid != nil {
+					colorPrint(red, "Invalid target: %v\n", invalid)
+					continue
+				}
+				prompt := strings.Join(args[i:], " ")
+				if len(targets) < 2 || prompt == "" {
+					colorPrint(yellow, "Usage: /compare <provider/model> <provider/model> ... <prompt>\n")
+					continue
+				}
+				comparison := chat.CompareModels(targets, prompt)
+				for i, target := range targets {
+					colorPrint(purple, "\n──── [%d] %s/%s ────\n", i+1, target[0], target[1])
+					result := comparison.Follow(i, func(text string) { fmt.Print(text) })
+					colorPrint(yellow, "\n%s\n", compareStats(result))
+				}
+				results := comparison.Wait()
+				colorPrint(cyan, "\nKeep which answer? [1-%d, Enter to discard]: ", len(results))
+				choice, ok := <-inputs
+				if !ok {
+					return
+				}
+				var pick int
+				if _, err := fmt.Sscanf(strings.TrimSpace(choice), "%d", &pick); err != nil || pick < 1 || pick > len(results) {
+					colorPrint(yellow, "Discarded all answers\n")
+					continue
+				}
+				if results[pick-1].Err != nil {
+					colorPrint(red, "Answer %d failed, nothing kept\n", pick)
+					continue
+				}
+				if err := chat.KeepComparison(prompt, results[pick-1]); err != nil {
+					colorPrint(red, "%s\n", describeError(err))
+				} else {
+					colorPrint(green, "✅ Kept answer from %s/%s\n", results[pick-1].Provider, results[pick-1].Model)
+				}
+				continue
+			case "tpl":
+				tplArgs := yuzu.SplitArgs(strings.TrimSpace(userInput[len("/tpl"):]))
+				if len(tplArgs) >= 1 && tplArgs[0] == "list" {
+					templates := yuzu.ListTemplates()
+					if len(templates) == 0 {
+						colorPrint(yellow, "No templates found in %s\n", strings.Join(yuzu.TemplateDirs(), ", "))
+						continue
+					}
+					colorPrint(cyan, "Available templates:\n")
+					for _, tpl := range templates {
+						fmt.Printf("  - %s (%s) %s\n", tpl.Name, strings.Join(tpl.Variables(), ", "), tpl.Path)
+					}
+					continue
+				}
+				if len(tplArgs) >= 3 && tplArgs[0] == "save" {
+					// The text is taken as typed so quotes in {{include "file"}} survive.
+					rest := strings.TrimSpace(strings.TrimSpace(userInput[len("/tpl"):])[len("save"):])
+					name, text, _ := strings.Cut(rest, " ")
+					if path, err := yuzu.SaveTemplate(name, strings.TrimSpace(text)); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Template '%s' saved to %s\n", name, path)
+					}
+					continue
+				}
+				if len(tplArgs) == 2 && tplArgs[0] == "delete" {
+					if path, err := yuzu.DeleteTemplate(tplArgs[1]); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Template '%s' deleted from %s\n", tplArgs[1], path)
+					}
+					continue
+				}
+				if len(tplArgs) < 2 || tplArgs[0] != "use" {
+					colorPrint(yellow, "Usage: /tpl list | /tpl use <name> key=value ... | /tpl save <name> <text> | /tpl delete <name>\n")
+					continue
+				}
+				vars, err := yuzu.ParseTemplateVars(tplArgs[2:])
+				if err != nil {
+					colorPrint(red, "Invalid template arguments: %v\n", err)
+					continue
+				}
+				rendered, err := yuzu.RenderTemplate(tplArgs[1], vars)
+				if err != nil {
+					colorPrint(red, "Template error: %v\n", err)
+					continue
+				}
+				colorPrint(yellow, "Thinking with %s/%s...\n", chat.CurrentProvider(), chat.CurrentModel())
+				printReply(chat, streaming, func(onDelta func(string)) (yuzu.Response, error) {
+					return chat.Stream(ctx, rendered, onDelta)
+				})
+				continue
+			case "persona":
+				if len(args) == 0 || args[0] == "list" {
+					names := chat.ListPersonas()
+					if len(names) == 0 {
+						colorPrint(yellow, "No personas yet. Create one with /persona new <name> [system prompt]\n")
+						continue
+					}
+					colorPrint(cyan, "Available personas:\n")
+					for _, name := range names {
+						if name == chat.PersonaName() {
+							colorPrint(yellow, "  - %s <- CURRENT\n", name)
+						} else {
+							fmt.Printf("  - %s\n", name)
+						}
+					}
+					continue
+				}
+				switch {
+				case args[0] == "use" && len(args) == 2:
+					warnings, err := chat.UsePersona(args[1])
+					switch {
+					case err != nil:
+						colorPrint(red, "%s\n", describeError(err))
+					case chat.PersonaName() == "":
+						colorPrint(green, "✅ Persona cleared, using system.txt\n")
+					default:
+						colorPrint(green, "✅ Persona changed to: %s\n", args[1])
+					}
+					for _, warning := range warnings {
+						colorPrint(yellow, "⚠️ %s\n", warning)
+					}
+				case args[0] == "new" && len(args) >= 2:
+					if filename, err := chat.NewPersona(args[1], strings.Join(args[2:], " ")); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Persona '%s' saved to %s\n", args[1], filename)
+					}
+				case args[0] == "edit" && len(args) >= 4:
+					if err := chat.EditPersona(args[1], args[2], strings.Join(args[3:], " ")); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Persona '%s' updated\n", args[1])
+					}
+				case args[0] == "delete" && len(args) == 2:
+					if err := chat.DeletePersona(args[1]); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Persona '%s' deleted\n", args[1])
+					}
+				default:
+					colorPrint(yellow, "Usage: /persona list | use <name|none> | new <name> [prompt] | edit <name> <field> <value> | delete <name>\n")
+					colorPrint(yellow, "Fields: system, provider, model, temperature, max_tokens\n")
+				}
+				continue
+			case "removekey":
+				if len(args) >= 1 {
+					provider := args[0]
+					if err := chat.RemoveAPIKey(provider); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ %s API key removed\n", provider)
+					}
+				} else {
+					colorPrint(yellow, "Usage: /removekey <provider>\n")
+					colorPrint(yellow, "Providers: chutes, openrouter, cerebras\n")
+				}
+				continue
+			case "system":
+				if len(args) == 0 {
+					colorPrint(cyan, "💡 Edit %s with your favorite editor; it is reloaded automatically when you save it.\n", chat.SystemFile())
+				} else if len(args) >= 1 && args[0] == "show" {
+					showSystemPrompt(chat, len(args) >= 2 && args[1] == "--expanded")
+				} else if len(args) >= 1 && args[0] == "reload" {
+					if prompt, err := chat.ReloadSystemPrompt(); err != nil {
+						colorPrint(red, "❌ Error loading system prompt: %v\n", err)
+					} else {
+						colorPrint(green, "✅ System prompt reloaded (%s)\n", promptSize(prompt))
+					}
+				} else {
+					newPrompt := strings.Join(args, " ")
+					if err := chat.SaveSystemPrompt(newPrompt); err != nil {
+						colorPrint(red, "Failed to save system prompt: %v\n", err)
+					} else {
+						colorPrint(green, "System prompt updated (%d chars)\n", len(newPrompt))
+					}
+				}
+				continue
+			case "help", "?":
+				colorPrint(cyan, `Available Commands:
+  /key <provider> <api_key> - Set API key for provider
+  /removekey <provider>     - Remove API key for provider
+  /keys check               - Validate all stored API keys
+  /keys startup on|off      - Validate keys at startup
+  /system <text>            - Set new system prompt inline
+  /system show [--expanded] - Display current system prompt, optionally with variables filled in
+  /system reload            - Reload system.txt
+  /persona list             - List personas
+  /persona use <name|none>  - Switch persona (prompt, provider, model, parameters)
+  /persona new <name> [prompt] - Create a persona from the current settings
+  /persona edit <name> <field> <value> - Change a persona field
+  /persona delete <name>    - Delete a persona
+  /provider <name>          - Switch provider
+  /providers                - List available providers
+  /model <name>             - Switch model
+  /models                   - List available models
+  /clear                    - Clear screen
+  /clearhistory             - Clear conversation history
+  /export <fmt> <path> [from] [to] - Export history (md, html, jsonl, txt)
+  /import <fmt> <path> [--new] [title|record] - Import chatgpt, jsonl or sillytavern chats
+  /search <query> [filters] - Search all archived messages
+  /search open|fork <n>     - Jump into or fork a search result
+  /compare <p/m> <p/m> ... <prompt> - Ask several models at once and keep one answer
+  /tpl list                 - List prompt templates
+  /tpl use <name> k=v ...   - Send a filled-in template ({{tpl:name k=v}} works inline)
+  /tpl save <name> <text>   - Save a template to templates/
+  /tpl delete <name>        - Delete a template
+  /history                  - List numbered messages of this conversation
+  /attach <path>            - Keep a copy of a file with this session
+  /attachments              - List files attached to this session
+  /undo                     - Drop the last exchange
+  /retry [model]            - Resend the last message, optionally with another model
+  /delete <n>               - Delete message n
+  /edit <n> <text>          - Rewrite user message n and continue on a new branch
+  /regen                    - Regenerate the last reply as a new branch
+  /branches                 - List branches of this conversation
+  /checkout <n>             - Switch to branch n
+  /info                     - Show current status
+  /stream                   - Toggle streaming mode
+  /json on|off              - Require replies to be valid JSON
+  /autocontinue on|off      - Continue replies cut off at the token limit
+  /autocontinue max <n>     - Continue a reply at most n times (default 3)
+  /debug on [file]|off      - Log raw provider traffic to stderr or a file
+  /log tail [n]             - Show the last n lines of yuzuchat.log (default 20)
+  /log level [level]        - Show or set the log level (debug, info, warn, error)
+  /exit, /bye               - Exit
+  /help, /?                 - Show this help
+`)
+				continue
+			case "providers":
+				providers := chat.ListProviders()
+				colorPrint(cyan, "Available providers:\n")
+				for _, p := range providers {
+					provider, _ := chat.Provider(p)
+					if p == chat.CurrentProvider() {
+						colorPrint(yellow, "  - %s <- CURRENT (%s)\n", p, provider.KeyFile)
+					} else {
+						fmt.Printf("  - %s (%s)\n", p, provider.KeyFile)
+					}
+				}
+				continue
+			case "provider":
+				if len(args) >= 1 {
+					if err := chat.ChangeProvider(args[0]); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Provider changed to: %s\n", args[0])
+					}
+				} else {
+					colorPrint(yellow, "Usage: /provider <provider_name>\n")
+				}
+				continue
+			case "models":
+				models := chat.ListModels()
+				colorPrint(cyan, "Available models for %s:\n", chat.CurrentProvider())
+				for _, m := range models {
+					if m == chat.CurrentModel() {
+						colorPrint(yellow, "  - %s <- CURRENT\n", m)
+					} else {
+						fmt.Printf("  - %s\n", m)
+					}
+				}
+				continue
+			case "model":
+				if len(args) >= 1 {
+					if model, err := chat.ChangeModel(strings.Join(args, " ")); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else {
+						colorPrint(green, "✅ Model changed to: %s\n", model)
+					}
+				} else {
+					colorPrint(yellow, "Usage: /model <model_name>\n")
+				}
+				continue
+			case "info":
+				colorPrint(cyan, "%s\n", describeInfo(chat.Info()))
+				continue
+			case "debug":
+				switch {
+				case len(args) >= 1 && args[0] == "on":
+					path := strings.Join(args[1:], " ")
+					if err := setDebug(chat, true, path); err != nil {
+						colorPrint(red, "❌ %v\n", err)
+					} else if path != "" {
+						colorPrint(green, "✅ Debug on: provider traffic is logged to %s\n", path)
+					} else {
+						colorPrint(green, "✅ Debug on: provider traffic is logged to stderr\n")
+					}
+				case len(args) == 1 && args[0] == "off":
+					setDebug(chat, false, "")
+					colorPrint(green, "✅ Debug off\n")
+				default:
+					colorPrint(yellow, "Usage: /debug on [file] | /debug off\n")
+				}
+				continue
+			case "log":
+				switch {
+				case len(args) >= 1 && len(args) <= 2 && args[0] == "tail":
+					n := 20
+					if len(args) == 2 {
+						var err error
+						if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+							colorPrint(red, "❌ Invalid line count '%s'\n", args[1])
+							continue
+						}
+					}
+					lines, err := chat.TailLog(n)
+					if err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+						continue
+					}
+					if len(lines) == 0 {
+						colorPrint(yellow, "📝 %s is empty\n", chat.LogPath())
+						continue
+					}
+					colorPrint(cyan, "📜 Last %d lines of %s:\n", len(lines), chat.LogPath())
+					for _, line := range lines {
+						fmt.Println(formatLogLine(line))
+					}
+				case len(args) == 1 && args[0] == "level":
+					colorPrint(cyan, "Log level: %s (%s)\n", chat.LogLevel(), chat.LogPath())
+				case len(args) == 2 && args[0] == "level":
+					if err := chat.SetLogLevel(args[1]); err != nil {
+						colorPrint(red, "❌ %v. Levels: %s\n", err, strings.Join(yuzu.LogLevels, ", "))
+					} else {
+						colorPrint(green, "✅ Log level set to %s for this session\n", chat.LogLevel())
+					}
+				default:
+					colorPrint(yellow, "Usage: /log tail [n] | /log level [debug|info|warn|error]\n")
+				}
+				continue
+			case "json":
+				if len(args) == 1 && (args[0] == "on" || args[0] == "off") {
+					chat.SetJSONMode(args[0] == "on")
+					if chat.JSONMode() {
+						colorPrint(green, "✅ JSON mode on: replies must be a single valid JSON value\n")
+					} else {
+						colorPrint(green, "✅ JSON mode off\n")
+					}
+					if chat.JSONMode() && streaming {
+						streaming = false
+						colorPrint(yellow, "Streaming: OFF (JSON replies are validated before they are shown)\n")
+					}
+				} else {
+					colorPrint(yellow, "Usage: /json on|off\n")
+				}
+				continue
+			case "autocontinue":
+				if len(args) == 2 && args[0] == "max" {
+					n, err := strconv.Atoi(args[1])
+					if err != nil {
+						colorPrint(red, "❌ Invalid count '%s'\n", args[1])
+					} else if err := chat.SetMaxContinuations(n); err != nil {
+						colorPrint(red, "❌ %v\n", err)
+					} else {
+						colorPrint(green, "✅ Up to %d continuations per reply\n", n)
+					}
+				} else if len(args) == 1 && (args[0] == "on" || args[0] == "off") {
+					if err := chat.SetAutoContinue(args[0] == "on"); err != nil {
+						colorPrint(red, "%s\n", describeError(err))
+					} else if chat.AutoContinue() {
+						colorPrint(green, "✅ Auto-continue on: cut-off replies are continued up to %d times and joined\n", chat.MaxContinuations())
+					} else {
+						colorPrint(green, "✅ Auto-continue off\n")
+					}
+				} else {
+					colorPrint(yellow, "Usage: /autocontinue on|off | /autocontinue max <n>\n")
+				}
+				continue
+			case "stream":
+				if chat.JSONMode() && !streaming {
+					colorPrint(yellow, "Streaming is unavailable in JSON mode, use /json off first\n")
+					continue
+				}
+				streaming = !streaming
+				colorPrint(yellow, "Streaming: %s\n", map[bool]string{true: "ON", false: "OFF"}[streaming])
+				continue
+			case "clear":
+				clearScreen()
+				colorPrint(cyan, "Screen cleared\n")
+				continue
+			case "clearhistory":
+				if err := chat.ClearHistory(); err != nil {
+					colorPrint(red, "❌ Error removing history: %v\n", err)
+				} else {
+					colorPrint(green, "✅ Conversation history cleared\n")
+				}
+				continue
+			default:
+				colorPrint(red, "Unknown command '/%s'. Type /? for help.\n", command)
+				continue
+			}
+		}
+		expanded, err := yuzu.ExpandInlineTemplates(userInput)
+		if err != nil {
+			colorPrint(red, "Template error: %v\n", err)
+			continue
+		}
+		colorPrint(yellow, "Thinking with %s/%s...\n", chat.CurrentProvider(), chat.CurrentModel())
+		printReply(chat, streaming, func(onDelta func(string)) (yuzu.Response, error) {
+			return chat.Stream(ctx, expanded, onDelta)
+		})
+	}
+}
+
+// titit 𓀐 𓂸
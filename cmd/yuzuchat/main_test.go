@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+	"github.com/icedeyes12/yuzuchat/yuzu"
+)
+
+func TestMain(m *testing.M) {
+	statusOutput = io.Discard
+	os.Exit(m.Run())
+}
+
+// newTestChat runs the test in a fresh directory holding a chutes key and
+// returns a client with every provider pointed at fake.
+func newTestChat(t *testing.T, fake *fakeprovider.Server) *yuzu.YuzuChat {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile("cu.key", []byte("test-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	chat, err := yuzu.New(filepath.Join(dir, "chat_history.json"), filepath.Join(dir, "profile.json"), filepath.Join(dir, "system.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chat.Close() })
+	for _, name := range []string{"chutes", "openrouter", "cerebras"} {
+		if err := chat.SetBaseURL(name, fake.BaseURL()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chat
+}
+
+var ansiCodes = regexp.MustCompile("\033\\[[0-9;]*[A-Za-z]")
+
+// captureOutput runs fn with stdout and status output going to a file and
+// returns what was written, without color codes.
+func captureOutput(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout, status := os.Stdout, statusOutput
+	os.Stdout, statusOutput = f, f
+	defer func() { os.Stdout, statusOutput = stdout, status }()
+	fn()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ansiCodes.ReplaceAllString(string(data), "")
+}
+
+func runLines(t *testing.T, chat *yuzu.YuzuChat, lines ...string) string {
+	t.Helper()
+	return captureOutput(t, func() {
+		runREPL(chat, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	})
+}
+
+func TestREPLConversation(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	output := runLines(t, chat, "hello", "/stream", "streamed hello", "/history")
+
+	for _, want := range []string{
+		"Thinking with chutes/deepseek-ai/DeepSeek-V3-0324",
+		"📨 1→2 tokens",
+		"AI: echo: hello",
+		"Streaming: ON",
+		"🤖: echo: streamed hello",
+		"📨 5→3 tokens",
+		"#4",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	if len(fake.Requests()) != 2 || !fake.LastRequest().Stream {
+		t.Errorf("requests = %+v", fake.Requests())
+	}
+}
+
+func TestREPLCommands(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"/provider nope", "provider 'nope' not found"},
+		{"/provider cerebras", "no API key in ce.key"},
+		{"/model coder", "✅ Model changed to: Qwen/Qwen3-Coder-480B-A35B-Instruct-FP8"},
+		{"/model nonexistent", "model 'nonexistent' not found for chutes"},
+		{"/models", "deepseek-ai/DeepSeek-V3-0324 <- CURRENT"},
+		{"/providers", "chutes"},
+		{"/key", "Usage: /key <provider> <api_key>"},
+		{"/key cerebras bad-key", "🔑 cerebras: authentication failed"},
+		{"/key cerebras good-key", "✅ cerebras API key saved"},
+		{"/json on", "✅ JSON mode on"},
+		{"/json maybe", "Usage: /json on|off"},
+		{"/autocontinue max 0", "at least one continuation is needed"},
+		{"/autocontinue max x", "Invalid count 'x'"},
+		{"/autocontinue", "Usage: /autocontinue on|off | /autocontinue max <n>"},
+		{"/debug on", "✅ Debug on: provider traffic is logged to stderr"},
+		{"/debug off", "✅ Debug off"},
+		{"/debug maybe", "Usage: /debug on [file] | /debug off"},
+		{"/log tail", "INFO  client started"},
+		{"/log tail x", "Invalid line count 'x'"},
+		{"/log level", "Log level: info"},
+		{"/log level debug", "✅ Log level set to debug for this session"},
+		{"/log level loud", "log level 'loud' not found. Levels: debug, info, warn, error"},
+		{"/log", "Usage: /log tail [n]"},
+		{"/attach", "Usage: /attach <path>"},
+		{"/attach missing.txt", "file 'missing.txt' not found"},
+		{"/attachments", "No attachments in this session"},
+		{"/undo", "❌"},
+		{"/delete 3", "message #3 not found"},
+		{"/delete x", "Invalid message number 'x'"},
+		{"/persona use ghost", "persona 'ghost' not found"},
+		{"/tpl save greet Say {{include \"hi.txt\"}} to {{name}}", "✅ Template 'greet' saved to templates/greet.tmpl"},
+		{"/tpl delete ghost", "template 'ghost' not found"},
+		{"/tpl", "Usage: /tpl list"},
+		{"/info", "Model: deepseek-ai/DeepSeek-V3-0324"},
+		{"/system", "system.txt with your favorite editor"},
+		{"/system show", "No system prompt set"},
+		{"/system reload", "✅ System prompt reloaded (empty)"},
+		{"/clearhistory", "✅ Conversation history cleared"},
+		{"/frobnicate", "Unknown command '/frobnicate'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			if output := runLines(t, chat, tt.line); !strings.Contains(output, tt.want) {
+				t.Errorf("output lacks %q:\n%s", tt.want, output)
+			}
+			if n := len(fake.Requests()); n != 0 {
+				t.Errorf("command sent %d chat requests", n)
+			}
+		})
+	}
+}
+
+func TestREPLExitStopsReading(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	output := runLines(t, chat, "/exit", "never sent")
+	if !strings.Contains(output, "Mata ne~!") {
+		t.Errorf("no goodbye:\n%s", output)
+	}
+	if len(fake.Requests()) != 0 {
+		t.Errorf("input after /exit was sent: %+v", fake.Requests())
+	}
+}
+
+func TestREPLSystemPrompt(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	output := runLines(t, chat, "/system Today is {{date}}", "/system show", "/system show --expanded", "/system reload")
+	for _, want := range []string{
+		"📋 Current system prompt (1 lines, 17 characters):",
+		"Today is {{date}}\n",
+		"Today is " + time.Now().Format("2006-01-02") + "\n",
+		"✅ System prompt reloaded (1 lines, 17 characters)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestREPLBranching(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{Content: "first answer"}, fakeprovider.Reply{Content: "second answer"})
+	output := runLines(t, chat, "question", "/regen", "/branches", "/checkout 1", "/history")
+	for _, want := range []string{"AI: first answer", "AI: second answer", "[2] 2 msgs", "✅ Switched to branch 1 (2 messages)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	if history := chat.History(); len(history) != 2 || history[1].Content != "first answer" {
+		t.Errorf("history after checkout = %+v", history)
+	}
+}
+
+func TestREPLShowsProviderErrors(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Status: 429, Error: "slow down", Headers: map[string]string{"Retry-After": "5"}},
+		fakeprovider.Reply{Status: 400, Error: "maximum context length exceeded"},
+	)
+	output := runLines(t, chat, "one", "two")
+	for _, want := range []string{
+		"⏳ chutes: rate limited (HTTP 429): slow down",
+		"Try again in 5s",
+		"📏 chutes: context length exceeded",
+		"/undo, /delete or /clearhistory",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	if len(chat.History()) != 0 {
+		t.Errorf("failed turns were kept: %+v", chat.History())
+	}
+}
+
+func TestREPLHintsAtCABundle(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	server := httptest.NewUnstartedServer(fake.Config.Handler)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	chat.SetBaseURL("chutes", server.URL+"/v1")
+	output := runLines(t, chat, "hi")
+	if !strings.Contains(output, "🔒 ") || !strings.Contains(output, `Set "ca_bundle" under "network"`) {
+		t.Errorf("output lacks the CA bundle hint:\n%s", output)
+	}
+}
+
+func TestREPLWarnsAboutCutOffReplies(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "half", FinishReason: "length"},
+		fakeprovider.Reply{Content: "hidden", FinishReason: "content_filter"},
+	)
+	output := runLines(t, chat, "one", "/stream", "two")
+	for _, want := range []string{"AI: half\n✂️ Reply cut off at the token limit", "🚫 Reply stopped by the provider's content filter"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestREPLAutoContinue(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "one ", FinishReason: "length"},
+		fakeprovider.Reply{Content: "two", FinishReason: "length"},
+	)
+	output := runLines(t, chat, "/autocontinue max 1", "/autocontinue on", "count")
+	for _, want := range []string{"✅ Up to 1 continuations per reply", "continued up to 1 times", "AI: one two\n✂️ Reply cut off at the token limit after 1 continuation"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunOneShot(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	var code int
+	output := captureOutput(t, func() {
+		code = runOneShot(chat, "just once", "", false, 0)
+	})
+	if code != 0 || output != "echo: just once\n" {
+		t.Errorf("exit %d, output %q", code, output)
+	}
+	if len(chat.History()) != 0 {
+		t.Errorf("one-shot prompt was stored: %+v", chat.History())
+	}
+}
+
+func TestRunOneShotExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply fakeprovider.Reply
+		json  bool
+		want  int
+	}{
+		{"auth", fakeprovider.Reply{Status: 401}, false, exitAuth},
+		{"rate limited", fakeprovider.Reply{Status: 429}, false, exitRateLimited},
+		{"quota", fakeprovider.Reply{Status: 402}, false, exitQuota},
+		{"context length", fakeprovider.Reply{Status: 400, Error: "context_length_exceeded"}, false, exitContextLength},
+		{"unavailable", fakeprovider.Reply{Status: 502}, false, exitUnavailable},
+		{"bad request", fakeprovider.Reply{Status: 400, Error: "bad temperature"}, false, exitError},
+		{"invalid json", fakeprovider.Reply{Content: "not json"}, true, exitInvalidReply},
+		{"malformed response", fakeprovider.Reply{Body: "{"}, false, exitInvalidReply},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			fake.Enqueue(tt.reply)
+			var code int
+			output := captureOutput(t, func() {
+				code = runOneShot(chat, "prompt", "", tt.json, 0)
+			})
+			if code != tt.want {
+				t.Errorf("exit %d, want %d; output:\n%s", code, tt.want, output)
+			}
+		})
+	}
+}
+
+func TestRunOneShotUsageErrors(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	captureOutput(t, func() {
+		if code := runOneShot(chat, "prompt", "missing.json", false, 0); code != exitUsage {
+			t.Errorf("missing schema: exit %d, want %d", code, exitUsage)
+		}
+		if code := runOneShot(chat, "{{tpl:nonexistent}}", "", false, 0); code != exitUsage {
+			t.Errorf("unknown template: exit %d, want %d", code, exitUsage)
+		}
+	})
+}
+
+func TestFormatLogLine(t *testing.T) {
+	line := `{"time":"2025-06-01T14:03:05.123+02:00","level":"ERROR","msg":"request failed","status":429,"error":"rate limited"}`
+	want := "06-01 14:03:05 ERROR request failed error=rate limited status=429"
+	if got := formatLogLine(line); got != want {
+		t.Errorf("formatLogLine = %q, want %q", got, want)
+	}
+	if got := formatLogLine("not json"); got != "not json" {
+		t.Errorf("non-JSON line = %q", got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if code := exitCode(errors.New("boom")); code != exitError {
+		t.Errorf("plain error: exit %d", code)
+	}
+	wrapped := &yuzu.ProviderError{Kind: yuzu.ErrNetwork, Provider: "chutes"}
+	if code := exitCode(wrapped); code != exitUnavailable {
+		t.Errorf("network error: exit %d", code)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	pattern := regexp.MustCompile("(?i)holes")
+	got := highlightSnippet(strings.Repeat("é", 50)+" black holes are dense", pattern)
+	want := "…" + strings.Repeat("é", 17) + " black " + string(yellow) + "holes" + string(reset) + " are dense"
+	if got != want {
+		t.Errorf("highlightSnippet = %q, want %q", got, want)
+	}
+	if got := highlightSnippet("no match here", pattern); got != "no match here" {
+		t.Errorf("without a match = %q", got)
+	}
+}
+
+func TestShowStartup(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	output := captureOutput(t, func() { showStartup(chat) })
+	for _, want := range []string{
+		"✅ chutes: API key loaded from cu.key",
+		"⚠️ cerebras: No API key found in ce.key",
+		"Total providers enabled: 1/3",
+		"Starting new conversation history",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
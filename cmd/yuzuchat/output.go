@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/icedeyes12/yuzuchat/yuzu"
+)
+
+type color string
+
+const (
+	red    color = "\033[31m"
+	green  color = "\033[32m"
+	yellow color = "\033[33m"
+	cyan   color = "\033[36m"
+	purple color = "\033[35m"
+	reset  color = "\033[0m"
+)
+
+// statusOutput receives colorPrint lines. One-shot mode points it at stderr
+// so that stdout carries only the reply.
+var statusOutput io.Writer = os.Stdout
+
+func colorPrint(c color, message string, args ...interface{}) {
+	fmt.Fprintf(statusOutput, string(c)+message+string(reset), args...)
+}
+
+// showStartup reports which providers have keys, the profile and the
+// history just loaded, and checks the keys if the profile asks for it.
+func showStartup(chat *yuzu.YuzuChat) {
+	enabled := 0
+	names := chat.ProviderNames()
+	for _, name := range names {
+		provider, _ := chat.Provider(name)
+		if provider.IsEnabled {
+			enabled++
+			colorPrint(green, "✅ %s: API key loaded from %s\n", name, provider.KeyFile)
+		} else {
+			colorPrint(yellow, "⚠️ %s: No API key found in %s\n", name, provider.KeyFile)
+		}
+	}
+	colorPrint(green, "\n🎯 Total providers enabled: %d/%d\n", enabled, len(names))
+	colorPrint(green, "📖 Profile loaded: %s provider, %s model\n", chat.CurrentProvider(), chat.CurrentModel())
+	if history := chat.History(); len(history) > 0 {
+		colorPrint(green, "📖 Loaded %d previous messages\n", len(history))
+	} else {
+		colorPrint(yellow, "📝 Starting new conversation history\n")
+	}
+	if chat.KeyCheckOnStartup() {
+		for _, check := range chat.CheckAPIKeys() {
+			colorPrint(cyan, "%s\n", describeKeyCheck(check))
+		}
+	}
+}
+
+// describeKeyCheck renders the outcome of probing a provider with a key.
+func describeKeyCheck(k yuzu.KeyCheck) string {
+	switch k.Status {
+	case "valid":
+		if k.Detail != "" {
+			return fmt.Sprintf("✅ %s: key valid (%s)", k.Provider, k.Detail)
+		}
+		return fmt.Sprintf("✅ %s: key valid", k.Provider)
+	case "invalid":
+		return fmt.Sprintf("❌ %s: key invalid or expired (%s)", k.Provider, k.Detail)
+	case "low_credit":
+		return fmt.Sprintf("⚠️ %s: key valid but low on credit (%s)", k.Provider, k.Detail)
+	default:
+		return fmt.Sprintf("⚠️ %s: could not verify key (%s)", k.Provider, k.Detail)
+	}
+}
+
+// describeInfo renders the /info status tree.
+func describeInfo(info yuzu.Info) string {
+	onOff := map[bool]string{true: "on", false: "off"}
+	persona := info.Persona
+	if persona == "" {
+		persona = "none"
+	}
+	return fmt.Sprintf(`
+🍊 Yuzu Prototype - HKMM Project
+├── Provider: %s (%s)
+├── Model: %s
+├── Persona: %s
+├── JSON mode: %s
+├── Auto-continue: %s
+├── System: %d lines (from system.txt)
+├── History: %d exchanges
+├── Enabled: %d/%d providers
+└── Context: ~%d chars
+	`, info.Provider, info.KeyFile, info.Model, persona, onOff[info.JSONMode], onOff[info.AutoContinue],
+		info.SystemLines, info.Messages/2, info.EnabledProviders, info.Providers, info.ContextChars)
+}
+
+// compareStats renders the timing and token line under a compared answer.
+func compareStats(r yuzu.CompareResult) string {
+	if r.Err != nil {
+		return fmt.Sprintf("❌ %v", r.Err)
+	}
+	stats := fmt.Sprintf("⏱️ %.2fs | ⚡ first token %.2fs | 📨 %d→%d tokens",
+		r.Latency.Seconds(), r.FirstToken.Seconds(), r.PromptTokens, r.CompletionTokens)
+	if r.Estimated {
+		stats = fmt.Sprintf("⏱️ %.2fs | ⚡ first token %.2fs | 🚀 ~%d tokens (estimated)",
+			r.Latency.Seconds(), r.FirstToken.Seconds(), r.CompletionTokens)
+	}
+	if r.FinishReason != "" && r.FinishReason != "stop" {
+		stats += " | ✂️ stopped: " + r.FinishReason
+	}
+	return stats
+}
+
+// highlightSnippet returns the text around the first match with the match
+// itself highlighted.
+func highlightSnippet(content string, pattern *regexp.Regexp) string {
+	snippet, start, end := yuzu.Snippet(content, pattern)
+	if start < 0 {
+		return snippet
+	}
+	return snippet[:start] + string(yellow) + snippet[start:end] + string(reset) + snippet[end:]
+}
+
+// describeReload renders a watched file being reloaded, or returns "" when
+// nothing was.
+func describeReload(chat *yuzu.YuzuChat, reload yuzu.Reload) string {
+	switch reload.Kind {
+	case "system":
+		return fmt.Sprintf("🔄 %s changed on disk, reloaded", reload.Path)
+	case "profile":
+		return fmt.Sprintf("🔄 %s changed on disk, now using %s/%s", reload.Path, chat.CurrentProvider(), chat.CurrentModel())
+	case "persona":
+		return fmt.Sprintf("🔄 Persona '%s' changed on disk, reloaded", reload.Name)
+	case "key":
+		if reload.Removed {
+			return fmt.Sprintf("🔄 %s API key removed from %s", reload.Name, reload.Path)
+		}
+		return fmt.Sprintf("🔄 %s API key reloaded from %s", reload.Name, reload.Path)
+	}
+	return ""
+}
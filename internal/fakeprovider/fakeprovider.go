@@ -0,0 +1,296 @@
+// Package fakeprovider is a scriptable OpenAI-compatible server for tests.
+// Replies are queued with Enqueue and served in order; once the queue is
+// empty every request gets an echo of its last message.
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Reply scripts the answer to one chat request.
+type Reply struct {
+	// Status is the HTTP status, 200 when zero. Other statuses send an
+	// OpenAI style error body with Error as the message.
+	Status int
+	Error  string
+	// Content is the reply text. Streamed requests get it in Chunks when
+	// those are set, or word by word otherwise.
+	Content      string
+	Chunks       []string
+	FinishReason string // "stop" when empty
+	Usage        *Usage
+	// NoUsage leaves usage out of a streamed reply, as providers do unless
+	// asked to include it.
+	NoUsage bool
+	// Body, when set, is sent verbatim instead of a generated body, for
+	// malformed payloads and hand-written SSE streams.
+	Body    string
+	Headers map[string]string
+	// Delay holds the response back before headers are sent; ChunkDelay
+	// spaces out streamed chunks.
+	Delay      time.Duration
+	ChunkDelay time.Duration
+}
+
+// Usage is the token accounting sent with a reply.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Message is a chat message as received in a request.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a chat request the server received.
+type Request struct {
+	Path          string
+	Authorization string
+	Model         string
+	Stream        bool
+	Messages      []Message
+	// Body is the whole decoded payload, for fields such as temperature or
+	// response_format.
+	Body map[string]interface{}
+	// RemoteAddr is the client end of the connection the request came on
+	// and Proto its protocol, such as "HTTP/2.0".
+	RemoteAddr string
+	Proto      string
+}
+
+// LastMessage returns the content of the final message of the request.
+func (r Request) LastMessage() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	return r.Messages[len(r.Messages)-1].Content
+}
+
+// Server is a running fake provider.
+type Server struct {
+	*httptest.Server
+	// InvalidKey is rejected with 401 by chat and key check requests.
+	InvalidKey string
+	// KeyInfo is served on GET /v1/key, as OpenRouter does.
+	KeyInfo string
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+}
+
+// New starts a server that is closed when the test ends.
+func New(t testing.TB) *Server {
+	s := &Server{InvalidKey: "bad-key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChat)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("GET /v1/key", s.handleKey)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// BaseURL is the API root to hand to the client under test.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Enqueue adds replies for the next chat requests.
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns the chat requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the most recent chat request.
+func (s *Server) LastRequest() Request {
+	requests := s.Requests()
+	if len(requests) == 0 {
+		return Request{}
+	}
+	return requests[len(requests)-1]
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") == "Bearer "+s.InvalidKey {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": "error", "code": nil},
+	})
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"object":"list","data":[{"id":"fake-model","object":"model"}]}`)
+}
+
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if s.KeyInfo != "" {
+		io.WriteString(w, s.KeyInfo)
+		return
+	}
+	io.WriteString(w, `{"data":{"usage":0,"limit_remaining":null,"is_free_tier":true}}`)
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	request := Request{Path: r.URL.Path, Authorization: r.Header.Get("Authorization"), RemoteAddr: r.RemoteAddr, Proto: r.Proto}
+	if err := json.Unmarshal(data, &request.Body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	var payload struct {
+		Model    string    `json:"model"`
+		Stream   bool      `json:"stream"`
+		Messages []Message `json:"messages"`
+	}
+	json.Unmarshal(data, &payload)
+	request.Model, request.Stream, request.Messages = payload.Model, payload.Stream, payload.Messages
+	if len(request.Messages) == 0 {
+		// An empty request probes the key without taking a reply.
+		if s.authorized(w, r) {
+			writeError(w, http.StatusBadRequest, "messages is required")
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	reply := Reply{Content: "echo: " + request.LastMessage()}
+	if len(s.replies) > 0 {
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	}
+	s.mu.Unlock()
+
+	if !s.authorized(w, r) {
+		return
+	}
+	if reply.Delay > 0 {
+		select {
+		case <-time.After(reply.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for name, value := range reply.Headers {
+		w.Header().Set(name, value)
+	}
+	status := reply.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch {
+	case reply.Body != "":
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, reply.Body)
+	case status != http.StatusOK:
+		writeError(w, status, reply.Error)
+	case request.Stream:
+		s.stream(w, r, request, reply)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion",
+			"model":   request.Model,
+			"choices": []interface{}{map[string]interface{}{"index": 0, "message": Message{Role: "assistant", Content: reply.Content}, "finish_reason": finishReason(reply)}},
+			"usage":   usage(reply, request),
+		})
+	}
+}
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, request Request, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(event interface{}) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunks := reply.Chunks
+	if chunks == nil {
+		chunks = strings.SplitAfter(reply.Content, " ")
+	}
+	for i, chunk := range chunks {
+		if i > 0 && reply.ChunkDelay > 0 {
+			select {
+			case <-time.After(reply.ChunkDelay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		send(map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]string{"content": chunk}}}})
+	}
+	last := map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]string{}, "finish_reason": finishReason(reply)}},
+	}
+	if !reply.NoUsage {
+		last["usage"] = usage(reply, request)
+	}
+	send(last)
+	io.WriteString(w, "data: [DONE]\n\n")
+}
+
+func finishReason(reply Reply) string {
+	if reply.FinishReason != "" {
+		return reply.FinishReason
+	}
+	return "stop"
+}
+
+func usage(reply Reply, request Request) Usage {
+	if reply.Usage != nil {
+		return *reply.Usage
+	}
+	prompt := 0
+	for _, message := range request.Messages {
+		prompt += len(strings.Fields(message.Content))
+	}
+	content := reply.Content
+	if content == "" {
+		content = strings.Join(reply.Chunks, "")
+	}
+	completion := len(strings.Fields(content))
+	return Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
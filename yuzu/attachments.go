@@ -0,0 +1,61 @@
+package yuzu
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxAttachmentSize keeps a stray /attach of a disk image out of the database.
+const maxAttachmentSize = 20 << 20
+
+// Attach keeps a copy of the file at path with the current session.
+func (y *YuzuChat) Attach(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return Attachment{}, fmt.Errorf("file '%s' %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return Attachment{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Attachment{}, fmt.Errorf("'%s' is not a regular file", path)
+	}
+	if info.Size() > maxAttachmentSize {
+		return Attachment{}, fmt.Errorf("'%s' is %d MB, attachments are limited to %d MB", path, info.Size()>>20, maxAttachmentSize>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	attachment := Attachment{
+		Session:   y.sessionID,
+		Name:      filepath.Base(path),
+		MimeType:  detectMimeType(path, data),
+		Data:      data,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	if err := y.store.SaveAttachment(attachment); err != nil {
+		y.logger.Error("saving attachment", "name", attachment.Name, "error", err.Error())
+		return Attachment{}, fmt.Errorf("%w: attachment: %w", ErrStorage, err)
+	}
+	y.logger.Info("file attached", "name", attachment.Name, "bytes", len(data), "session", y.sessionID)
+	return attachment, nil
+}
+
+// Attachments returns the files attached to the current session, oldest
+// first.
+func (y *YuzuChat) Attachments() ([]Attachment, error) {
+	return y.store.LoadAttachments(y.sessionID)
+}
+
+// detectMimeType goes by the file extension, then by the contents.
+func detectMimeType(name string, data []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,211 @@
+package yuzu
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+func newMessageID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func lastMessageID(messages []Message) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1].ID
+}
+
+// linkMessages gives every message without an ID one, chaining each to the
+// message before it, with the first attached to parentID.
+func linkMessages(messages []Message, parentID string) {
+	for i := range messages {
+		if messages[i].ID == "" {
+			messages[i].ID = newMessageID()
+			messages[i].ParentID = parentID
+		}
+		parentID = messages[i].ID
+	}
+}
+
+// messageTree indexes one session's archived messages by their parent links.
+type messageTree struct {
+	nodes    map[string]Message
+	children map[string][]string
+	order    []string
+}
+
+func buildMessageTree(archive []Message, session string) *messageTree {
+	tree := &messageTree{nodes: map[string]Message{}, children: map[string][]string{}}
+	for _, msg := range archive {
+		if msg.Session != session || msg.ID == "" {
+			continue
+		}
+		if _, seen := tree.nodes[msg.ID]; seen {
+			continue
+		}
+		tree.nodes[msg.ID] = msg
+		tree.children[msg.ParentID] = append(tree.children[msg.ParentID], msg.ID)
+		tree.order = append(tree.order, msg.ID)
+	}
+	return tree
+}
+
+// pathTo returns the messages from the root down to id.
+func (t *messageTree) pathTo(id string) []Message {
+	var path []Message
+	for id != "" {
+		msg, ok := t.nodes[id]
+		if !ok {
+			break
+		}
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// latestLeaf follows the most recent child from id down to a leaf.
+func (t *messageTree) latestLeaf(id string) string {
+	for {
+		children := t.children[id]
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1]
+	}
+}
+
+// Branch is one root-to-leaf path through the current session.
+type Branch struct {
+	Path    []Message
+	Current bool
+	// Diverge is the index of the first message not shared with the current
+	// branch.
+	Diverge int
+}
+
+func (y *YuzuChat) Branches() ([]Branch, error) {
+	archive, err := y.loadArchive()
+	if err != nil {
+		return nil, err
+	}
+	tree := buildMessageTree(archive, y.sessionID)
+	currentLeaf := lastMessageID(y.conversationHistory)
+	currentPath := tree.pathTo(currentLeaf)
+	var branches []Branch
+	for _, id := range tree.order {
+		if len(tree.children[id]) > 0 {
+			continue
+		}
+		branch := Branch{Path: tree.pathTo(id), Current: id == currentLeaf}
+		for branch.Diverge < len(branch.Path) && branch.Diverge < len(currentPath) &&
+			branch.Path[branch.Diverge].ID == currentPath[branch.Diverge].ID {
+			branch.Diverge++
+		}
+		branches = append(branches, branch)
+	}
+	return branches, nil
+}
+
+// Checkout makes branch n (as numbered by /branches) the active conversation
+// and returns its length.
+func (y *YuzuChat) Checkout(n int) (int, error) {
+	branches, err := y.Branches()
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > len(branches) {
+		return 0, fmt.Errorf("branch #%d %w", n, ErrNotFound)
+	}
+	y.conversationHistory = branches[n-1].Path
+	y.trimHistory()
+	return len(branches[n-1].Path), y.saveHistory()
+}
+
+// EditMessage replaces user message n of the current conversation with text
+// and sends it, leaving the original exchange on its own branch. The edit
+// takes the original's parent, which lies outside a trimmed window when n is
+// 1. The reply is streamed to onDelta when that is set.
+func (y *YuzuChat) EditMessage(ctx context.Context, n int, text string, onDelta func(string)) (Response, error) {
+	if n < 1 || n > len(y.conversationHistory) {
+		return Response{}, fmt.Errorf("message #%d %w", n, ErrNotFound)
+	}
+	if y.conversationHistory[n-1].Role != "user" {
+		return Response{}, fmt.Errorf("message #%d is not a user message", n)
+	}
+	base := y.conversationHistory[:n-1]
+	user := y.newMessage("user", text, y.conversationHistory[n-1].ParentID)
+	return y.turn(ctx, base, &user, onDelta)
+}
+
+// Regenerate asks for a new reply to the last user message; the previous
+// reply stays available as a sibling branch.
+func (y *YuzuChat) Regenerate(ctx context.Context, onDelta func(string)) (Response, error) {
+	count := len(y.conversationHistory)
+	if count < 2 || y.conversationHistory[count-1].Role != "assistant" || y.conversationHistory[count-2].Role != "user" {
+		return Response{}, errors.New("nothing to regenerate")
+	}
+	return y.turn(ctx, y.conversationHistory[:count-1], nil, onDelta)
+}
+
+// Undo drops the last exchange from the conversation and returns how many
+// messages were removed. They stay in the archive and remain reachable
+// through /branches.
+func (y *YuzuChat) Undo() (int, error) {
+	count := len(y.conversationHistory)
+	if count == 0 {
+		return 0, errors.New("nothing to undo")
+	}
+	drop := 1
+	if y.conversationHistory[count-1].Role == "assistant" && count >= 2 && y.conversationHistory[count-2].Role == "user" {
+		drop = 2
+	}
+	y.conversationHistory = y.conversationHistory[:count-drop]
+	return drop, y.saveHistory()
+}
+
+// Retry resends the last user message, using model for this one request if
+// it is not empty.
+func (y *YuzuChat) Retry(ctx context.Context, model string, onDelta func(string)) (Response, error) {
+	if model == "" {
+		return y.Regenerate(ctx, onDelta)
+	}
+	resolved, ok := y.findModel(model)
+	if !ok {
+		return Response{}, fmt.Errorf("model '%s' %w for %s", model, ErrNotFound, y.currentProvider)
+	}
+	previous := y.model
+	y.model = resolved
+	defer func() { y.model = previous }()
+	return y.Regenerate(ctx, onDelta)
+}
+
+// DeleteMessage removes message n from the conversation. The messages after
+// it are re-linked as a new branch under its parent, so the original order
+// stays in the archive.
+func (y *YuzuChat) DeleteMessage(n int) error {
+	if n < 1 || n > len(y.conversationHistory) {
+		return fmt.Errorf("message #%d %w", n, ErrNotFound)
+	}
+	history := make([]Message, 0, len(y.conversationHistory)-1)
+	history = append(history, y.conversationHistory[:n-1]...)
+	rest := append([]Message{}, y.conversationHistory[n:]...)
+	for i := range rest {
+		rest[i].ID = ""
+	}
+	linkMessages(rest, y.conversationHistory[n-1].ParentID)
+	y.conversationHistory = append(history, rest...)
+	if err := y.appendToArchive(rest...); err != nil {
+		return err
+	}
+	return y.saveHistory()
+}
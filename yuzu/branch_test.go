@@ -0,0 +1,173 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func sendAll(t *testing.T, chat *YuzuChat, messages ...string) {
+	t.Helper()
+	for _, message := range messages {
+		if _, err := chat.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func contents(messages []Message) []string {
+	var out []string
+	for _, msg := range messages {
+		out = append(out, msg.Content)
+	}
+	return out
+}
+
+// fillWindow sends enough messages that the window no longer starts at the
+// root of the session.
+func fillWindow(t *testing.T, chat *YuzuChat) {
+	t.Helper()
+	for i := 1; i <= maxHistoryMessages/2+1; i++ {
+		sendAll(t, chat, fmt.Sprintf("question %d", i))
+	}
+	if first := chat.History()[0]; first.Role != "user" || first.ParentID == "" {
+		t.Fatalf("window starts with %+v, the test needs it trimmed at a user message", first)
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	sendAll(t, chat, "one", "two")
+	original := chat.History()
+
+	if _, err := chat.EditMessage(context.Background(), 3, "TWO", nil); err != nil {
+		t.Fatal(err)
+	}
+	history := chat.History()
+	if got := fmt.Sprint(contents(history)); got != "[one echo: one TWO echo: TWO]" {
+		t.Fatalf("history after edit = %s", got)
+	}
+	if history[2].ParentID != original[1].ID || history[2].ID == original[2].ID {
+		t.Errorf("edit is not a sibling of the original message")
+	}
+	if sent := fake.LastRequest().Messages; len(sent) != 3 || sent[2].Content != "TWO" {
+		t.Errorf("edit sent %+v", sent)
+	}
+	branches, err := chat.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 || branches[0].Current || !branches[1].Current || branches[0].Diverge != 2 {
+		t.Fatalf("branches = %+v", branches)
+	}
+	if _, err := chat.Checkout(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(contents(chat.History())); got != "[one echo: one two echo: two]" {
+		t.Errorf("history after checkout = %s", got)
+	}
+
+	if _, err := chat.EditMessage(context.Background(), 2, "x", nil); err == nil {
+		t.Error("edited an assistant message")
+	}
+	if _, err := chat.EditMessage(context.Background(), 5, "x", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("message #5: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestEditFirstMessageOfTrimmedWindow(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	fillWindow(t, chat)
+	first := chat.History()[0]
+
+	if _, err := chat.EditMessage(context.Background(), 1, "edited", nil); err != nil {
+		t.Fatal(err)
+	}
+	if edited := chat.History()[0]; edited.Content != "edited" || edited.ParentID != first.ParentID {
+		t.Fatalf("edit parented on %q, want %q", edited.ParentID, first.ParentID)
+	}
+	branches, err := chat.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, branch := range branches {
+		if branch.Path[0].Content != "question 1" {
+			t.Errorf("branch starts at %q, want the session root", branch.Path[0].Content)
+		}
+		if branch.Current && len(branch.Path) != 4 {
+			t.Errorf("edited branch = %v", contents(branch.Path))
+		}
+		if !branch.Current && branch.Diverge != 2 {
+			t.Errorf("original branch diverges at %d, want 2", branch.Diverge)
+		}
+	}
+	if len(branches) != 2 {
+		t.Errorf("%d branches, want 2", len(branches))
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	sendAll(t, chat, "one", "two", "three")
+	if err := chat.DeleteMessage(3); err != nil {
+		t.Fatal(err)
+	}
+	history := chat.History()
+	if got := fmt.Sprint(contents(history)); got != "[one echo: one echo: two three echo: three]" {
+		t.Fatalf("history after delete = %s", got)
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].ParentID != history[i-1].ID {
+			t.Errorf("message %d is not linked to the one before it", i+1)
+		}
+	}
+	if branches, err := chat.Branches(); err != nil || len(branches) != 2 {
+		t.Errorf("branches after delete = %d, %v", len(branches), err)
+	}
+	if err := chat.DeleteMessage(6); !errors.Is(err, ErrNotFound) {
+		t.Errorf("message #6: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteFirstMessageOfTrimmedWindow(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	fillWindow(t, chat)
+	first := chat.History()[0]
+	if err := chat.DeleteMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	if history := chat.History(); history[0].ParentID != first.ParentID {
+		t.Errorf("remaining messages parented on %q, want %q", history[0].ParentID, first.ParentID)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if _, err := chat.Undo(); err == nil {
+		t.Error("undo of an empty conversation succeeded")
+	}
+	sendAll(t, chat, "one", "two")
+	if n, err := chat.Undo(); err != nil || n != 2 {
+		t.Fatalf("Undo = %d, %v", n, err)
+	}
+	if got := fmt.Sprint(contents(chat.History())); got != "[one echo: one]" {
+		t.Errorf("history after undo = %s", got)
+	}
+	sendAll(t, chat, "three")
+	branches, err := chat.Branches()
+	if err != nil || len(branches) != 2 {
+		t.Fatalf("branches after undo and send = %d, %v", len(branches), err)
+	}
+	if got := fmt.Sprint(contents(branches[0].Path)); got != "[one echo: one two echo: two]" {
+		t.Errorf("undone exchange = %s, want it kept on a branch", got)
+	}
+
+	chat.conversationHistory = chat.conversationHistory[:3]
+	if n, err := chat.Undo(); err != nil || n != 1 {
+		t.Errorf("undo of a trailing user message = %d, %v", n, err)
+	}
+}
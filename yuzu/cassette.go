@@ -0,0 +1,372 @@
+package yuzu
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A cassette is a directory of recorded provider interactions, one JSON file
+// each, numbered in the order they were made. Response bodies are stored as
+// the chunks they arrived in, with the delay before each, so replayed
+// streams keep their timing.
+type cassetteInteraction struct {
+	Request  cassetteRequest   `json:"request"`
+	Response *cassetteResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type cassetteRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Chunks  []cassetteChunk   `json:"chunks"`
+}
+
+type cassetteChunk struct {
+	DelayMs int64  `json:"delay_ms"`
+	Data    string `json:"data"`
+}
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are never written to a cassette.
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Api-Key":       true,
+	"X-Api-Key":     true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+var cassetteNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Record saves every provider request and response under dir while still
+// talking to the providers, with API keys redacted.
+func (y *YuzuChat) Record(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	y.SetTransport(&recordingTransport{dir: dir, next: y.roundTripper(), count: len(existing), logger: y.logger})
+	return nil
+}
+
+// Replay answers provider requests from the cassette in dir instead of the
+// network. A request is matched to the first unused recording with the same
+// method, URL and body, or failing that one that differs only in its
+// messages, so that a prompt with {{date}} in it still replays on another
+// day.
+func (y *YuzuChat) Replay(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("cassette %s %w", dir, ErrNotFound)
+	}
+	sort.Strings(files)
+	replay := &replayTransport{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var interaction cassetteInteraction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		replay.interactions = append(replay.interactions, interaction)
+	}
+	replay.used = make([]bool, len(replay.interactions))
+	// Providers in the cassette are usable without a key file, so tests
+	// and bug reports replay on machines that have no keys.
+	for _, provider := range y.providers {
+		for _, interaction := range replay.interactions {
+			if interaction.Request.URL == provider.BaseURL {
+				provider.IsEnabled = true
+			}
+		}
+	}
+	y.SetTransport(replay)
+	return nil
+}
+
+type recordingTransport struct {
+	dir    string
+	next   http.RoundTripper
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	count int
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	secrets := requestSecrets(req)
+	interaction := cassetteInteraction{Request: cassetteRequest{
+		Method:  req.Method,
+		URL:     redact(req.URL.String(), secrets),
+		Headers: redactedHeaders(req.Header),
+		Body:    redact(string(body), secrets),
+	}}
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	started := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		interaction.Error = redact(err.Error(), secrets)
+		t.save(interaction)
+		return nil, err
+	}
+	interaction.Response = &cassetteResponse{Status: resp.StatusCode, Headers: redactedHeaders(resp.Header)}
+	resp.Body = &recordingBody{
+		body:        resp.Body,
+		last:        started,
+		secrets:     secrets,
+		interaction: interaction,
+		save:        t.save,
+	}
+	return resp, nil
+}
+
+// save writes interaction as the next file of the cassette.
+func (t *recordingTransport) save(interaction cassetteInteraction) {
+	t.mu.Lock()
+	t.count++
+	name := fmt.Sprintf("%04d-%s-%s.json", t.count, strings.ToLower(interaction.Request.Method), cassetteSlug(interaction.Request.URL))
+	t.mu.Unlock()
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(t.dir, name), data, 0600, false)
+	}
+	if err != nil {
+		t.logger.Error("recording interaction", "file", name, "error", err.Error())
+	}
+}
+
+func cassetteSlug(rawURL string) string {
+	rawURL = strings.TrimPrefix(strings.TrimPrefix(rawURL, "https://"), "http://")
+	rawURL, _, _ = strings.Cut(rawURL, "?")
+	return strings.Trim(cassetteNameInvalidChars.ReplaceAllString(rawURL, "-"), "-")
+}
+
+// recordingBody passes a response body through while noting each chunk and
+// when it arrived. The interaction is saved once the body is read to the
+// end or closed.
+type recordingBody struct {
+	body        io.ReadCloser
+	last        time.Time
+	secrets     []string
+	interaction cassetteInteraction
+	save        func(cassetteInteraction)
+	saved       bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		now := time.Now()
+		b.interaction.Response.Chunks = append(b.interaction.Response.Chunks, cassetteChunk{
+			DelayMs: now.Sub(b.last).Milliseconds(),
+			Data:    redact(string(p[:n]), b.secrets),
+		})
+		b.last = now
+	}
+	if err != nil && err != io.EOF {
+		b.interaction.Error = redact(err.Error(), b.secrets)
+	}
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.body.Close()
+}
+
+func (b *recordingBody) finish() {
+	if !b.saved {
+		b.saved = true
+		b.save(b.interaction)
+	}
+}
+
+// requestSecrets returns the credentials a request carries, so they can be
+// scrubbed from everything written to the cassette.
+func requestSecrets(req *http.Request) []string {
+	var secrets []string
+	for name := range sensitiveHeaders {
+		value := req.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if token, found := strings.CutPrefix(value, "Bearer "); found {
+			value = token
+		}
+		if len(value) >= 8 {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+func redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+func redactedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = redacted
+		} else {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+	return headers
+}
+
+type replayTransport struct {
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	used         []bool
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	interaction, found := t.take(req.Method, req.URL.String(), string(body))
+	if !found {
+		return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, req.URL)
+	}
+	if interaction.Response == nil {
+		return nil, errors.New(interaction.Error)
+	}
+	header := make(http.Header)
+	for name, value := range interaction.Response.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode: interaction.Response.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       &replayBody{req: req, chunks: interaction.Response.Chunks, err: interaction.Error},
+		Request:    req,
+	}, nil
+}
+
+// take claims the recording that best matches a request.
+func (t *replayTransport) take(method, url, body string) (cassetteInteraction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sameBody := range []bool{true, false} {
+		for i, interaction := range t.interactions {
+			recorded := interaction.Request
+			if t.used[i] || recorded.Method != method || recorded.URL != url {
+				continue
+			}
+			if sameBody && recorded.Body != body || !sameBody && requestShape(recorded.Body) != requestShape(body) {
+				continue
+			}
+			t.used[i] = true
+			return interaction, true
+		}
+	}
+	return cassetteInteraction{}, false
+}
+
+// requestShape is a request body without its messages: the model, stream
+// flag and parameters that must match for a recording to stand in.
+func requestShape(body string) string {
+	var payload map[string]interface{}
+	if json.Unmarshal([]byte(body), &payload) != nil {
+		return body
+	}
+	delete(payload, "messages")
+	shape, _ := json.Marshal(payload)
+	return string(shape)
+}
+
+// replayBody plays back recorded chunks with their original delays, ending
+// with the recorded read error if the stream broke off.
+type replayBody struct {
+	req     *http.Request
+	chunks  []cassetteChunk
+	pending string
+	err     string
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	if b.pending == "" {
+		if len(b.chunks) == 0 {
+			if b.err != "" {
+				return 0, errors.New(b.err)
+			}
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if chunk.DelayMs > 0 {
+			timer := time.NewTimer(time.Duration(chunk.DelayMs) * time.Millisecond)
+			select {
+			case <-timer.C:
+			case <-b.req.Context().Done():
+				timer.Stop()
+				return 0, b.req.Context().Err()
+			}
+		}
+		b.pending = chunk.Data
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	cassette := filepath.Join(t.TempDir(), "cassette")
+	if err := chat.Record(cassette); err != nil {
+		t.Fatal(err)
+	}
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "plain answer"},
+		fakeprovider.Reply{Chunks: []string{"slow ", "stream"}, ChunkDelay: 100 * time.Millisecond},
+		fakeprovider.Reply{Status: 429, Error: "slow down"},
+	)
+	if _, err := chat.Send(context.Background(), "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Stream(context.Background(), "second", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "third"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v, want ErrRateLimited", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cassette, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("recorded %d interactions, want 3", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "test-key") {
+			t.Errorf("%s contains the API key", file)
+		}
+	}
+
+	fake.Close()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	replayed := openChat(t, dir, fake)
+	defer replayed.Close()
+	if err := replayed.Replay(cassette); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := replayed.Send(context.Background(), "first")
+	if err != nil || resp.Content != "plain answer" {
+		t.Fatalf("replayed %q, %v", resp.Content, err)
+	}
+	var deltas []string
+	started := time.Now()
+	resp, err = replayed.Stream(context.Background(), "second", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil || resp.Content != "slow stream" {
+		t.Fatalf("replayed %q, %v", resp.Content, err)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("stream replayed in %s, recorded timing lost", elapsed)
+	}
+	if _, err := replayed.Send(context.Background(), "third"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want the recorded ErrRateLimited", err)
+	}
+	if _, err := replayed.Send(context.Background(), "unrecorded"); !errors.Is(err, ErrNetwork) {
+		t.Errorf("got %v, want ErrNetwork for a request with no recording", err)
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if err := chat.Replay(filepath.Join(t.TempDir(), "nothing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,344 @@
+package yuzu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (y *YuzuChat) newMessage(role, content, parentID string) Message {
+	return Message{
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Model:     y.model,
+		Provider:  y.currentProvider,
+		Session:   y.sessionID,
+		ID:        newMessageID(),
+		ParentID:  parentID,
+		Persona:   y.PersonaName(),
+	}
+}
+
+// commitTurn makes base, user and reply the active conversation, linking
+// reply under the last of them, and returns reply as stored. A nil user
+// means base already ends with the user turn, as when regenerating. The
+// turn stays in memory even when it cannot be written.
+func (y *YuzuChat) commitTurn(base []Message, user *Message, reply Message) (Message, error) {
+	history := make([]Message, len(base), len(base)+2)
+	copy(history, base)
+	var added []Message
+	if user != nil {
+		history = append(history, *user)
+		added = append(added, *user)
+	}
+	reply.ParentID = lastMessageID(history)
+	history = append(history, reply)
+	added = append(added, reply)
+	y.conversationHistory = history
+	y.trimHistory()
+	if err := y.appendToArchive(added...); err != nil {
+		return reply, err
+	}
+	return reply, y.saveHistory()
+}
+
+func (y *YuzuChat) trimHistory() {
+	if len(y.conversationHistory) > maxHistoryMessages {
+		y.conversationHistory = y.conversationHistory[len(y.conversationHistory)-maxHistoryMessages:]
+	}
+}
+
+// chatMessages builds the request messages: system prompt, base, then user.
+func (y *YuzuChat) chatMessages(base []Message, user *Message) []map[string]string {
+	messages := []map[string]string{}
+	systemPrompt := y.expandPromptVariables(y.activeSystemPrompt())
+	if instruction := y.jsonInstruction(); instruction != "" {
+		systemPrompt = strings.TrimSpace(systemPrompt + "\n\n" + instruction)
+	}
+	if systemPrompt != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": systemPrompt})
+	}
+	for _, msg := range base {
+		messages = append(messages, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	if user != nil {
+		messages = append(messages, map[string]string{"role": "user", "content": user.Content})
+	}
+	return messages
+}
+
+func (y *YuzuChat) newChatRequest(providerName, model string, messages []map[string]string, stream bool) (*http.Request, error) {
+	provider := y.providers[providerName]
+	temperature, maxTokens := y.generationParams()
+	payload := map[string]interface{}{
+		"model":       model,
+		"messages":    messages,
+		"temperature": temperature,
+		"max_tokens":  maxTokens,
+		"stream":      stream,
+	}
+	if format := y.responseFormat(provider); format != nil {
+		payload["response_format"] = format
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request: %w", err)
+	}
+	return y.newProviderRequest(providerName, payloadBytes)
+}
+
+// newProviderRequest prepares a POST of body to the provider's chat endpoint
+// with its key and headers.
+func (y *YuzuChat) newProviderRequest(providerName string, body []byte) (*http.Request, error) {
+	provider := y.providers[providerName]
+	req, err := http.NewRequest("POST", provider.BaseURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	if providerName == "openrouter" {
+		req.Header.Set("HTTP-Referer", "https://github.com/icedeyes12/yuzuchat")
+		req.Header.Set("X-Title", "Yuzu-Prototype")
+	}
+	return req, nil
+}
+
+// Usage is the token accounting reported with a reply.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Response is the outcome of a successful Send or Stream.
+type Response struct {
+	Content  string
+	Provider string
+	Model    string
+	Usage    Usage
+	// Estimated is set when the completion tokens were counted from the
+	// streamed text rather than reported by the provider.
+	Estimated bool
+	// FinishReason is why the model stopped: "stop", "length" when it hit
+	// the token limit, "content_filter", or whatever else the provider sent.
+	FinishReason string
+	// Continuations counts the requests made to finish a reply that was cut
+	// off at the token limit, with auto-continue on.
+	Continuations int
+	Duration      time.Duration
+	// Message is the assistant message as stored in the history.
+	Message Message
+	// RequestID tags the request's records in the log.
+	RequestID string
+}
+
+// Send sends message as the next user turn with the current provider and
+// model, and returns the reply, which is added to the history.
+func (y *YuzuChat) Send(ctx context.Context, message string) (Response, error) {
+	user := y.newMessage("user", message, lastMessageID(y.conversationHistory))
+	return y.turn(ctx, y.conversationHistory, &user, nil)
+}
+
+// Stream is Send with the reply passed to onDelta piece by piece as it
+// arrives. A nil onDelta makes it the same as Send. In JSON mode the reply
+// has to be validated first, so onDelta gets it in one piece at the end.
+func (y *YuzuChat) Stream(ctx context.Context, message string, onDelta func(string)) (Response, error) {
+	user := y.newMessage("user", message, lastMessageID(y.conversationHistory))
+	return y.turn(ctx, y.conversationHistory, &user, onDelta)
+}
+
+// unavailableError explains why the current provider cannot be used.
+func (y *YuzuChat) unavailableError() error {
+	provider, exists := y.providers[y.currentProvider]
+	if !exists {
+		return fmt.Errorf("provider '%s' %w", y.currentProvider, ErrNotFound)
+	}
+	return &ProviderError{Kind: ErrProviderUnavailable, Provider: y.currentProvider, Message: "no API key in " + provider.KeyFile}
+}
+
+// turn requests a reply with base as the prior conversation followed by
+// user, if any, streaming it to onDelta when that is set, and commits the
+// exchange on success.
+func (y *YuzuChat) turn(ctx context.Context, base []Message, user *Message, onDelta func(string)) (Response, error) {
+	provider, exists := y.providers[y.currentProvider]
+	if !exists || !provider.IsEnabled {
+		return Response{}, y.unavailableError()
+	}
+	messages := y.chatMessages(base, user)
+	ctx, log := y.startRequest(ctx, "send", y.currentProvider, y.model)
+	startTime := time.Now()
+	var result completion
+	var err error
+	streamed := onDelta != nil && !y.wantsJSON()
+	if streamed {
+		result, err = y.streamReply(ctx, y.currentProvider, y.model, messages, onDelta)
+	} else {
+		result, err = y.structuredReply(ctx, y.currentProvider, y.model, messages)
+		if err == nil && onDelta != nil {
+			onDelta(result.Content)
+		}
+	}
+	continuations := 0
+	if err == nil {
+		result, continuations = y.continueReply(ctx, y.currentProvider, y.model, messages, onDelta, result)
+	}
+	finishRequest(log, startTime, result.Usage, result.FinishReason, err)
+	if err != nil {
+		return Response{}, err
+	}
+	reply, saveErr := y.commitTurn(base, user, y.newMessage("assistant", result.Content, ""))
+	response := Response{
+		Content:       result.Content,
+		Provider:      y.currentProvider,
+		Model:         y.model,
+		Usage:         result.Usage,
+		Estimated:     result.Estimated,
+		FinishReason:  result.FinishReason,
+		Continuations: continuations,
+		Duration:      time.Since(startTime),
+		Message:       reply,
+		RequestID:     requestID(ctx),
+	}
+	y.recordMetric(Metric{
+		Provider:         response.Provider,
+		Model:            response.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		DurationMs:       response.Duration.Milliseconds(),
+		Streamed:         streamed,
+	})
+	return response, saveErr
+}
+
+// httpClient returns a client for provider requests using the configured
+// transport, logging the traffic in debug mode. Chat requests pass no
+// timeout and are bounded by send instead.
+func (y *YuzuChat) httpClient(timeout time.Duration) *http.Client {
+	transport := y.roundTripper()
+	if y.debugOutput != nil {
+		transport = &debugTransport{next: transport, out: y.debugOutput}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// completion is one reply from a provider.
+type completion struct {
+	Content      string
+	Usage        Usage
+	FinishReason string
+	// Estimated is set when a streamed reply came without usage and the
+	// completion tokens were counted from the text.
+	Estimated bool
+}
+
+// requestReply performs a non-streamed chat request and returns the reply.
+func (y *YuzuChat) requestReply(providerName string, req *http.Request) (completion, error) {
+	resp, err := y.send(providerName, req)
+	if err != nil {
+		return completion{}, networkError(providerName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return completion{}, responseError(providerName, resp)
+	}
+	var apiResp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage Usage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		if errors.Is(err, ErrTimeout) {
+			return completion{}, networkError(providerName, err)
+		}
+		return completion{}, parseError(providerName, err)
+	}
+	if len(apiResp.Choices) == 0 {
+		return completion{}, parseError(providerName, errors.New("no choices in response"))
+	}
+	return completion{
+		Content:      apiResp.Choices[0].Message.Content,
+		Usage:        apiResp.Usage,
+		FinishReason: apiResp.Choices[0].FinishReason,
+	}, nil
+}
+
+// streamReply performs a streamed chat request, passing each piece of the
+// reply to onDelta, and returns the whole reply with the usage the provider
+// reported, or an estimate when it sent none. When
+// the stream breaks off, the text passed to onDelta so far is returned with
+// the error.
+func (y *YuzuChat) streamReply(ctx context.Context, providerName, model string, messages []map[string]string, onDelta func(string)) (completion, error) {
+	req, err := y.newChatRequest(providerName, model, messages, true)
+	if err != nil {
+		return completion{}, fmt.Errorf("request creation failed: %w", err)
+	}
+	resp, err := y.send(providerName, req.WithContext(ctx))
+	if err != nil {
+		return completion{}, networkError(providerName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return completion{}, responseError(providerName, resp)
+	}
+	reply, err := readChatStream(y.log(ctx), providerName, resp.Body, onDelta)
+	result := completion{Content: reply.Content, FinishReason: reply.FinishReason}
+	if reply.Usage != nil {
+		result.Usage = *reply.Usage
+	} else {
+		result.Usage = Usage{CompletionTokens: len(reply.Content) / 4}
+		result.Estimated = true
+	}
+	return result, err
+}
+
+// AskOnce answers prompt as a fresh conversation without reading or saving
+// the stored history, for one-shot use from scripts.
+func (y *YuzuChat) AskOnce(ctx context.Context, prompt string) (Response, error) {
+	provider, exists := y.providers[y.currentProvider]
+	if !exists || !provider.IsEnabled {
+		return Response{}, y.unavailableError()
+	}
+	user := y.newMessage("user", prompt, "")
+	ctx, log := y.startRequest(ctx, "ask", y.currentProvider, y.model)
+	startTime := time.Now()
+	messages := y.chatMessages(nil, &user)
+	result, err := y.structuredReply(ctx, y.currentProvider, y.model, messages)
+	continuations := 0
+	if err == nil {
+		result, continuations = y.continueReply(ctx, y.currentProvider, y.model, messages, nil, result)
+	}
+	finishRequest(log, startTime, result.Usage, result.FinishReason, err)
+	if err != nil {
+		return Response{}, err
+	}
+	response := Response{
+		Content:       result.Content,
+		Provider:      y.currentProvider,
+		Model:         y.model,
+		Usage:         result.Usage,
+		FinishReason:  result.FinishReason,
+		Continuations: continuations,
+		Duration:      time.Since(startTime),
+		Message:       y.newMessage("assistant", result.Content, user.ID),
+		RequestID:     requestID(ctx),
+	}
+	y.recordMetric(Metric{
+		Provider:         response.Provider,
+		Model:            response.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		DurationMs:       response.Duration.Milliseconds(),
+	})
+	return response, nil
+}
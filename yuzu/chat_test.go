@@ -0,0 +1,293 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestSend(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{
+		Content: "hello there",
+		Usage:   &fakeprovider.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9},
+	})
+
+	resp, err := chat.Send(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "hello there" || resp.Provider != "chutes" || resp.Model != chat.CurrentModel() {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 7 || resp.Usage.CompletionTokens != 2 || resp.Estimated {
+		t.Errorf("usage = %+v, estimated %v", resp.Usage, resp.Estimated)
+	}
+
+	req := fake.LastRequest()
+	if req.Authorization != "Bearer test-key" {
+		t.Errorf("Authorization = %q", req.Authorization)
+	}
+	if req.Model != chat.CurrentModel() || req.Stream {
+		t.Errorf("request model %s stream %v", req.Model, req.Stream)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "hi" {
+		t.Errorf("request messages = %+v", req.Messages)
+	}
+	if req.Body["temperature"] != 0.7 || req.Body["response_format"] != nil {
+		t.Errorf("request body = %v", req.Body)
+	}
+
+	history := chat.History()
+	if len(history) != 2 || history[0].Content != "hi" || history[1].Content != "hello there" {
+		t.Fatalf("history = %+v", history)
+	}
+	if history[1].ParentID != history[0].ID || resp.Message.ID != history[1].ID {
+		t.Errorf("reply not linked under the user message: %+v", history)
+	}
+}
+
+func TestSendIncludesSystemPromptAndHistory(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if err := chat.SaveSystemPrompt("You are {{provider}}."); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"first", "second"} {
+		if _, err := chat.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := fake.LastRequest().Messages
+	var roles []string
+	for _, message := range messages {
+		roles = append(roles, message.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("roles = %v", roles)
+	}
+	if messages[0].Content != "You are chutes." {
+		t.Errorf("system prompt = %q", messages[0].Content)
+	}
+	if messages[2].Content != "echo: first" {
+		t.Errorf("previous reply = %q", messages[2].Content)
+	}
+}
+
+func TestStream(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{
+		Chunks: []string{"Hel", "lo, ", "world"},
+		Usage:  &fakeprovider.Usage{PromptTokens: 9, CompletionTokens: 3, TotalTokens: 12},
+	})
+
+	var deltas []string
+	resp, err := chat.Stream(context.Background(), "hi", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deltas, "|") != "Hel|lo, |world" {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if resp.Content != "Hello, world" || resp.Estimated || resp.Usage != (Usage{PromptTokens: 9, CompletionTokens: 3, TotalTokens: 12}) {
+		t.Errorf("response = %+v, want the reported usage", resp)
+	}
+	if !fake.LastRequest().Stream {
+		t.Error("request was not streamed")
+	}
+	if history := chat.History(); len(history) != 2 || history[1].Content != "Hello, world" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestStreamWithoutUsage(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetAutoContinue(true)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "sixteen letters ", FinishReason: "length", Usage: &fakeprovider.Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6}},
+		fakeprovider.Reply{Content: "and eight", NoUsage: true},
+	)
+	resp, err := chat.Stream(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Estimated || resp.Usage.PromptTokens != 4 || resp.Usage.CompletionTokens != 2+len("and eight")/4 {
+		t.Errorf("usage %+v, estimated %v; want the estimate added to the reported part", resp.Usage, resp.Estimated)
+	}
+}
+
+func TestStreamIgnoresMalformedEvents(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{
+		Headers: map[string]string{"Content-Type": "text/event-stream"},
+		Body: ": keep-alive\n\n" +
+			`data: {"choices":[{"delta":{"content":"ok"}}]}` + "\n\n" +
+			"data: {not json}\n\n" +
+			`data: {"choices":[]}` + "\n\n" +
+			"data: [DONE]\n\n",
+	})
+	var streamed strings.Builder
+	resp, err := chat.Stream(context.Background(), "hi", func(delta string) { streamed.WriteString(delta) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "ok" || streamed.String() != "ok" {
+		t.Errorf("content %q, streamed %q", resp.Content, streamed.String())
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  fakeprovider.Reply
+		stream bool
+		want   error
+		status int
+	}{
+		{"unauthorized", fakeprovider.Reply{Status: 401, Error: "invalid api key"}, false, ErrAuth, 401},
+		{"rate limited", fakeprovider.Reply{Status: 429, Error: "slow down", Headers: map[string]string{"Retry-After": "3"}}, false, ErrRateLimited, 429},
+		{"quota", fakeprovider.Reply{Status: 402, Error: "insufficient credits"}, false, ErrQuotaExceeded, 402},
+		{"context length", fakeprovider.Reply{Status: 400, Error: "This model's maximum context length is 8192 tokens"}, false, ErrContextLength, 400},
+		{"server error", fakeprovider.Reply{Status: 503, Error: "overloaded"}, false, ErrProviderUnavailable, 503},
+		{"bad request", fakeprovider.Reply{Status: 400, Error: "unknown field"}, false, ErrBadRequest, 400},
+		{"malformed body", fakeprovider.Reply{Body: `{"choices": [`}, false, ErrParse, 0},
+		{"no choices", fakeprovider.Reply{Body: `{"choices": []}`}, false, ErrParse, 0},
+		{"stream unauthorized", fakeprovider.Reply{Status: 401, Error: "invalid api key"}, true, ErrAuth, 401},
+		{"stream server error", fakeprovider.Reply{Status: 500}, true, ErrProviderUnavailable, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			fake.Enqueue(tt.reply)
+			var onDelta func(string)
+			if tt.stream {
+				onDelta = func(string) {}
+			}
+			_, err := chat.Stream(context.Background(), "hi", onDelta)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("%T is not a *ProviderError", err)
+			}
+			if providerErr.Provider != "chutes" || providerErr.StatusCode != tt.status {
+				t.Errorf("error %+v", providerErr)
+			}
+			if tt.reply.Error != "" && providerErr.Message != tt.reply.Error {
+				t.Errorf("message = %q, want %q", providerErr.Message, tt.reply.Error)
+			}
+			if len(chat.History()) != 0 {
+				t.Errorf("failed turn was added to the history: %+v", chat.History())
+			}
+		})
+	}
+}
+
+func TestSendRetryAfter(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{Status: 429, Headers: map[string]string{"Retry-After": "12"}})
+	_, err := chat.Send(context.Background(), "hi")
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.RetryAfter != 12*time.Second {
+		t.Errorf("got %v, want a RetryAfter of 12s", err)
+	}
+}
+
+func TestSendNetworkError(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Close()
+	_, err := chat.Send(context.Background(), "hi")
+	if !errors.Is(err, ErrNetwork) {
+		t.Errorf("got %v, want ErrNetwork", err)
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "too late", Delay: 5 * time.Second},
+		fakeprovider.Reply{Content: "too late", Delay: 5 * time.Second},
+	)
+	for _, stream := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		var onDelta func(string)
+		if stream {
+			onDelta = func(string) {}
+		}
+		started := time.Now()
+		_, err := chat.Stream(ctx, "hi", onDelta)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("stream=%v: got %v, want context.DeadlineExceeded", stream, err)
+		}
+		if elapsed := time.Since(started); elapsed > 2*time.Second {
+			t.Errorf("stream=%v: cancellation took %s", stream, elapsed)
+		}
+	}
+}
+
+func TestSendWithoutKey(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if err := chat.RemoveAPIKey("chutes"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := chat.Send(context.Background(), "hi")
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("got %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	for i := 0; i < maxHistoryMessages; i++ {
+		if _, err := chat.Send(context.Background(), "message"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(chat.History()) != maxHistoryMessages {
+		t.Errorf("history has %d messages, want %d", len(chat.History()), maxHistoryMessages)
+	}
+	archive, err := chat.loadArchive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive) != 2*maxHistoryMessages {
+		t.Errorf("archive has %d messages, want %d", len(archive), 2*maxHistoryMessages)
+	}
+}
+
+func TestAskOnceLeavesHistoryAlone(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if _, err := chat.Send(context.Background(), "remember me"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := chat.AskOnce(context.Background(), "one-off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "echo: one-off" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if messages := fake.LastRequest().Messages; len(messages) != 1 {
+		t.Errorf("one-shot request carried the history: %+v", messages)
+	}
+	if len(chat.History()) != 2 {
+		t.Errorf("history changed: %+v", chat.History())
+	}
+}
@@ -0,0 +1,190 @@
+package yuzu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompareResult is one model's answer in a /compare run.
+type CompareResult struct {
+	Provider         string
+	Model            string
+	Content          string
+	Err              error
+	FirstToken       time.Duration
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+	FinishReason     string
+}
+
+// parseCompareTarget splits "provider/model" and resolves the model against
+// that provider's list.
+func (y *YuzuChat) ParseCompareTarget(target string) (string, string, error) {
+	name, model, found := strings.Cut(target, "/")
+	provider, exists := y.providers[strings.ToLower(name)]
+	if !found || !exists {
+		return "", "", fmt.Errorf("'%s' is not <provider>/<model>", target)
+	}
+	if !provider.IsEnabled {
+		return "", "", fmt.Errorf("provider '%s' is not enabled (no API key in %s)", name, provider.KeyFile)
+	}
+	resolved, ok := findModelIn(provider, model)
+	if !ok {
+		return "", "", fmt.Errorf("model '%s' not found for %s", model, name)
+	}
+	return strings.ToLower(name), resolved, nil
+}
+
+// Comparison is a /compare run in progress. Every target streams into a
+// buffer of its own as fast as the provider sends, so a pane that is not on
+// screen yet never holds up its response or trips its idle timeout.
+type Comparison struct {
+	chat  *YuzuChat
+	panes []*comparePane
+}
+
+// comparePane collects one target's answer while it streams.
+type comparePane struct {
+	mu      sync.Mutex
+	text    strings.Builder
+	changed chan struct{} // closed and replaced whenever text or done change
+	done    bool
+	result  CompareResult
+}
+
+func (p *comparePane) write(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text.WriteString(text)
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *comparePane) finish(result CompareResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result = result
+	p.done = true
+	close(p.changed)
+}
+
+// CompareModels sends the conversation plus prompt to every target at once
+// and returns straight away. Follow shows the answers as they arrive.
+func (y *YuzuChat) CompareModels(targets [][2]string, prompt string) *Comparison {
+	messages := y.chatMessages(y.conversationHistory, &Message{Role: "user", Content: prompt})
+	comparison := &Comparison{chat: y, panes: make([]*comparePane, len(targets))}
+	for i, target := range targets {
+		pane := &comparePane{changed: make(chan struct{})}
+		comparison.panes[i] = pane
+		go func(providerName, model string) {
+			pane.finish(y.streamComparison(providerName, model, messages, pane.write))
+		}(target[0], target[1])
+	}
+	return comparison
+}
+
+// Follow passes target i's answer to onDelta, first what has already
+// arrived and then the rest as it streams, and returns its result once the
+// answer is complete.
+func (c *Comparison) Follow(i int, onDelta func(string)) CompareResult {
+	pane := c.panes[i]
+	sent := 0
+	for {
+		pane.mu.Lock()
+		text := pane.text.String()[sent:]
+		done, changed, result := pane.done, pane.changed, pane.result
+		pane.mu.Unlock()
+		if text != "" {
+			onDelta(text)
+			sent += len(text)
+		}
+		if done {
+			return result
+		}
+		<-changed
+	}
+}
+
+// Wait returns every target's result once all have finished, recording the
+// metrics of the ones that succeeded. Call it once per comparison.
+func (c *Comparison) Wait() []CompareResult {
+	results := make([]CompareResult, len(c.panes))
+	for i := range c.panes {
+		results[i] = c.Follow(i, func(string) {})
+		if results[i].Err != nil {
+			continue
+		}
+		c.chat.recordMetric(Metric{
+			Provider:         results[i].Provider,
+			Model:            results[i].Model,
+			PromptTokens:     results[i].PromptTokens,
+			CompletionTokens: results[i].CompletionTokens,
+			DurationMs:       results[i].Latency.Milliseconds(),
+			Streamed:         true,
+		})
+	}
+	return results
+}
+
+// streamComparison streams one target's answer into onDelta, timing the
+// first token and the whole answer from the network reads.
+func (y *YuzuChat) streamComparison(providerName, model string, messages []map[string]string, onDelta func(string)) (result CompareResult) {
+	result = CompareResult{Provider: providerName, Model: model, Estimated: true}
+	ctx, log := y.startRequest(context.Background(), "compare", providerName, model)
+	startTime := time.Now()
+	defer func() {
+		finishRequest(log, startTime, Usage{PromptTokens: result.PromptTokens, CompletionTokens: result.CompletionTokens}, result.FinishReason, result.Err)
+	}()
+	req, err := y.newChatRequest(providerName, model, messages, true)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	resp, err := y.send(providerName, req.WithContext(ctx))
+	if err != nil {
+		result.Err = networkError(providerName, err)
+		return result
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		result.Err = responseError(providerName, resp)
+		return result
+	}
+	reply, err := readChatStream(log, providerName, resp.Body, func(text string) {
+		if result.FirstToken == 0 {
+			result.FirstToken = time.Since(startTime)
+		}
+		onDelta(text)
+	})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if reply.Usage != nil {
+		result.PromptTokens = reply.Usage.PromptTokens
+		result.CompletionTokens = reply.Usage.CompletionTokens
+		result.Estimated = false
+	}
+	result.FinishReason = reply.FinishReason
+	result.Latency = time.Since(startTime)
+	result.Content = reply.Content
+	if result.Estimated {
+		result.CompletionTokens = len(result.Content) / 4
+	}
+	return result
+}
+
+// KeepComparison stores prompt and the chosen answer as the next exchange.
+func (y *YuzuChat) KeepComparison(prompt string, result CompareResult) error {
+	user := y.newMessage("user", prompt, lastMessageID(y.conversationHistory))
+	reply := y.newMessage("assistant", result.Content, "")
+	reply.Provider = result.Provider
+	reply.Model = result.Model
+	_, err := y.commitTurn(y.conversationHistory, &user, reply)
+	return err
+}
@@ -0,0 +1,51 @@
+package yuzu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestComparePanesKeepStreaming(t *testing.T) {
+	first, second := fakeprovider.New(t), fakeprovider.New(t)
+	chat := newTestChat(t, first)
+	chat.SetBaseURL("cerebras", second.BaseURL())
+	chat.providers["cerebras"].APIKey = "test-key"
+	chat.providers["cerebras"].IsEnabled = true
+	// The second pane outgrows any small buffer long before the first is
+	// shown, and waiting on the screen would trip its idle timeout.
+	for _, name := range []string{"chutes", "cerebras"} {
+		chat.SetTimeouts(name, Timeouts{FirstByte: time.Second, Idle: 200 * time.Millisecond})
+	}
+	chunks := func(word string) []string {
+		var chunks []string
+		for i := 0; i < 400; i++ {
+			chunks = append(chunks, word)
+		}
+		return chunks
+	}
+	first.Enqueue(fakeprovider.Reply{Chunks: chunks("a"), ChunkDelay: 2 * time.Millisecond})
+	second.Enqueue(fakeprovider.Reply{Chunks: chunks("b")})
+
+	comparison := chat.CompareModels([][2]string{{"chutes", "slow"}, {"cerebras", "fast"}}, "hi")
+	var shown []string
+	for i := 0; i < 2; i++ {
+		var pane strings.Builder
+		comparison.Follow(i, func(text string) { pane.WriteString(text) })
+		shown = append(shown, pane.String())
+	}
+	results := comparison.Wait()
+	for i, want := range []string{strings.Repeat("a", 400), strings.Repeat("b", 400)} {
+		if results[i].Err != nil {
+			t.Fatalf("pane %d: %v", i+1, results[i].Err)
+		}
+		if shown[i] != want || results[i].Content != want {
+			t.Errorf("pane %d showed %d bytes and kept %d, want %d", i+1, len(shown[i]), len(results[i].Content), len(want))
+		}
+	}
+	if results[1].Latency >= results[0].Latency {
+		t.Errorf("fast pane latency %s, slow pane %s: time spent waiting to be shown was counted", results[1].Latency, results[0].Latency)
+	}
+}
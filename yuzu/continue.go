@@ -0,0 +1,95 @@
+package yuzu
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultMaxContinuations caps how many times a cut-off reply is continued.
+const DefaultMaxContinuations = 3
+
+// continuePrompt asks for the rest of a reply from providers that cannot
+// take a partial assistant message to carry on from.
+const continuePrompt = "Your reply was cut off. Continue exactly where you stopped, without repeating anything or adding a preamble."
+
+// SetAutoContinue turns automatic continuation of replies cut off at the
+// token limit on or off and saves it in the profile.
+func (y *YuzuChat) SetAutoContinue(enabled bool) error {
+	y.autoContinue = enabled
+	return y.saveProfile()
+}
+
+// AutoContinue reports whether cut-off replies are continued automatically.
+func (y *YuzuChat) AutoContinue() bool {
+	return y.autoContinue
+}
+
+// SetMaxContinuations sets how many continuation requests one reply may
+// take and saves it in the profile.
+func (y *YuzuChat) SetMaxContinuations(n int) error {
+	if n < 1 {
+		return fmt.Errorf("at least one continuation is needed, got %d", n)
+	}
+	y.maxContinuations = n
+	return y.saveProfile()
+}
+
+// MaxContinuations returns how many continuation requests one reply may take.
+func (y *YuzuChat) MaxContinuations() int {
+	return y.maxContinuations
+}
+
+// profileMaxContinuations is the cap as saved in the profile, zero for the
+// default.
+func (y *YuzuChat) profileMaxContinuations() int {
+	if y.maxContinuations == DefaultMaxContinuations {
+		return 0
+	}
+	return y.maxContinuations
+}
+
+// continueReply asks for the rest of a reply that stopped at the token limit
+// until it finishes or maxContinuations is reached, passing the new text on
+// to onDelta when streaming. Providers with AssistantPrefill resume from the
+// partial reply sent as the last assistant message; the others get it back
+// followed by continuePrompt. The parts are joined into one completion whose
+// usage covers every request. A failed continuation is logged and the reply
+// kept as far as it got, including text already streamed to onDelta, with
+// FinishReason still "length" to show it was cut off. JSON mode is left
+// alone, since it already re-asks for a reply that does not parse.
+func (y *YuzuChat) continueReply(ctx context.Context, providerName, model string, messages []map[string]string, onDelta func(string), reply completion) (completion, int) {
+	if !y.autoContinue || y.wantsJSON() {
+		return reply, 0
+	}
+	prefill := y.providers[providerName].AssistantPrefill
+	continuations := 0
+	for reply.FinishReason == "length" && continuations < y.maxContinuations {
+		continuations++
+		y.log(ctx).Info("continuing cut-off reply", "continuation", continuations, "prefill", prefill)
+		request := append(append([]map[string]string{}, messages...), map[string]string{"role": "assistant", "content": reply.Content})
+		if !prefill {
+			request = append(request, map[string]string{"role": "user", "content": continuePrompt})
+		}
+		var part completion
+		var err error
+		if onDelta != nil {
+			part, err = y.streamReply(ctx, providerName, model, request, onDelta)
+		} else {
+			part, err = y.structuredReply(ctx, providerName, model, request)
+		}
+		reply.Content += part.Content
+		reply.Usage.PromptTokens += part.Usage.PromptTokens
+		reply.Usage.CompletionTokens += part.Usage.CompletionTokens
+		reply.Usage.TotalTokens += part.Usage.TotalTokens
+		reply.Estimated = reply.Estimated || part.Estimated
+		if err != nil {
+			y.log(ctx).Warn("continuation failed", "continuation", continuations, "kept", len(part.Content), "error", err.Error())
+			if part.Content == "" {
+				continuations--
+			}
+			return reply, continuations
+		}
+		reply.FinishReason = part.FinishReason
+	}
+	return reply, continuations
+}
@@ -0,0 +1,173 @@
+package yuzu
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestAutoContinue(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		prefill bool
+		stream  bool
+	}{
+		{name: "continue prompt"},
+		{name: "continue prompt streamed", stream: true},
+		{name: "prefill", prefill: true},
+		{name: "prefill streamed", prefill: true, stream: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			chat.SetAutoContinue(true)
+			provider, _ := chat.Provider("chutes")
+			provider.AssistantPrefill = tt.prefill
+			fake.Enqueue(
+				fakeprovider.Reply{Content: "The quick brown ", FinishReason: "length"},
+				fakeprovider.Reply{Content: "fox jumps over ", FinishReason: "length"},
+				fakeprovider.Reply{Content: "the lazy dog."},
+			)
+			var streamed string
+			var resp Response
+			var err error
+			if tt.stream {
+				resp, err = chat.Stream(context.Background(), "pangram please", func(delta string) { streamed += delta })
+			} else {
+				resp, err = chat.Send(context.Background(), "pangram please")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "The quick brown fox jumps over the lazy dog."
+			if resp.Content != want || resp.FinishReason != "stop" || resp.Continuations != 2 {
+				t.Errorf("reply %q, finish %q, %d continuations", resp.Content, resp.FinishReason, resp.Continuations)
+			}
+			if tt.stream && streamed != want {
+				t.Errorf("streamed %q", streamed)
+			}
+			history := chat.History()
+			if len(history) != 2 || history[1].Content != want {
+				t.Errorf("history = %+v, want one stitched reply", history)
+			}
+			requests := fake.Requests()
+			if len(requests) != 3 {
+				t.Fatalf("%d requests, want 3", len(requests))
+			}
+			last := requests[2].Messages
+			partial := "The quick brown fox jumps over "
+			if tt.prefill {
+				if tail := last[len(last)-1]; tail.Role != "assistant" || tail.Content != partial {
+					t.Errorf("last message = %+v, want the partial reply to prefill", tail)
+				}
+			} else {
+				if tail := last[len(last)-2]; tail.Role != "assistant" || tail.Content != partial {
+					t.Errorf("second to last message = %+v, want the partial reply", tail)
+				}
+				if tail := last[len(last)-1]; tail.Role != "user" || tail.Content != continuePrompt {
+					t.Errorf("last message = %+v, want the continue prompt", tail)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoContinueCap(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetAutoContinue(true)
+	chat.SetMaxContinuations(2)
+	for i := 0; i < 4; i++ {
+		fake.Enqueue(fakeprovider.Reply{Content: "more ", FinishReason: "length"})
+	}
+	resp, err := chat.Send(context.Background(), "go on forever")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "more more more " || resp.FinishReason != "length" || resp.Continuations != 2 {
+		t.Errorf("reply %q, finish %q, %d continuations", resp.Content, resp.FinishReason, resp.Continuations)
+	}
+	if n := len(fake.Requests()); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestAutoContinueFailureKeepsPartialReply(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetAutoContinue(true)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "first half", FinishReason: "length"},
+		fakeprovider.Reply{Status: 500, Error: "boom"},
+	)
+	resp, err := chat.Send(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "first half" || resp.FinishReason != "length" || resp.Continuations != 0 {
+		t.Errorf("reply %q, finish %q, %d continuations", resp.Content, resp.FinishReason, resp.Continuations)
+	}
+}
+
+func TestAutoContinueStreamBreakKeepsShownText(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetAutoContinue(true)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "first half ", FinishReason: "length"},
+		fakeprovider.Reply{
+			Headers: map[string]string{"Content-Type": "text/event-stream"},
+			Body:    "data: {\"choices\":[{\"delta\":{\"content\":\"and a bit\"}}]}\n\n",
+		},
+	)
+	var streamed string
+	resp, err := chat.Stream(context.Background(), "hi", func(delta string) { streamed += delta })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "first half and a bit" || streamed != resp.Content {
+		t.Errorf("reply %q, streamed %q", resp.Content, streamed)
+	}
+	if resp.FinishReason != "length" || resp.Continuations != 1 {
+		t.Errorf("finish %q, %d continuations; want it marked cut off", resp.FinishReason, resp.Continuations)
+	}
+	if history := chat.History(); history[1].Content != streamed {
+		t.Errorf("stored %q, shown %q", history[1].Content, streamed)
+	}
+}
+
+func TestAutoContinueOff(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "half", FinishReason: "length"},
+		fakeprovider.Reply{Content: "unused"},
+	)
+	resp, err := chat.Send(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "half" || resp.Continuations != 0 || len(fake.Requests()) != 1 {
+		t.Errorf("reply %q after %d requests", resp.Content, len(fake.Requests()))
+	}
+}
+
+func TestMaxContinuationsSaved(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if err := chat.SetMaxContinuations(0); err == nil {
+		t.Error("a cap of 0 was accepted")
+	}
+	if err := chat.SetMaxContinuations(5); err != nil {
+		t.Fatal(err)
+	}
+	chat.Close()
+	dir, _ := os.Getwd()
+	reopened := openChat(t, dir, fake)
+	defer reopened.Close()
+	if n := reopened.MaxContinuations(); n != 5 {
+		t.Errorf("max continuations after restart = %d, want 5", n)
+	}
+}
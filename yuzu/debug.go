@@ -0,0 +1,178 @@
+package yuzu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetDebug logs every provider request and response to w: the payload,
+// status, headers and raw body lines, with API keys redacted. nil turns
+// debug mode off.
+func (y *YuzuChat) SetDebug(w io.Writer) {
+	y.debugOutput = w
+}
+
+// Debugging reports whether provider traffic is being logged.
+func (y *YuzuChat) Debugging() bool {
+	return y.debugOutput != nil
+}
+
+var (
+	debugMu       sync.Mutex // keeps lines from concurrent requests whole
+	debugRequests atomic.Int64
+)
+
+// debugTransport logs the traffic passing through it. Each line carries the
+// request number so that parallel /compare requests can be told apart.
+type debugTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+}
+
+func (t *debugTransport) logf(id int64, format string, args ...interface{}) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	fmt.Fprintf(t.out, "[#%d] "+format+"\n", append([]interface{}{id}, args...)...)
+}
+
+func (t *debugTransport) logHeaders(id int64, header http.Header) {
+	headers := redactedHeaders(header)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.logf(id, "   %s: %s", name, headers[name])
+	}
+}
+
+// isRateLimitHeader matches the x-ratelimit-*, ratelimit-* and Retry-After
+// headers providers use to report limits.
+func isRateLimitHeader(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "ratelimit") || strings.Contains(name, "rate-limit") || name == "retry-after"
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := debugRequests.Add(1)
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	secrets := requestSecrets(req)
+	if request := requestID(req.Context()); request != "" {
+		t.logf(id, "→ %s %s %s (request %s)", time.Now().Format("15:04:05.000"), req.Method, redact(req.URL.String(), secrets), request)
+	} else {
+		t.logf(id, "→ %s %s %s", time.Now().Format("15:04:05.000"), req.Method, redact(req.URL.String(), secrets))
+	}
+	t.logHeaders(id, req.Header)
+	if len(body) > 0 {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "", "  ") == nil {
+			body = pretty.Bytes()
+		}
+		for _, line := range strings.Split(redact(string(body), secrets), "\n") {
+			t.logf(id, "   %s", line)
+		}
+	}
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	started := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		t.logf(id, "✗ %s after %s: %v", time.Now().Format("15:04:05.000"), time.Since(started).Round(time.Millisecond), err)
+		return nil, err
+	}
+	t.logf(id, "← %s %s after %s", time.Now().Format("15:04:05.000"), resp.Status, time.Since(started).Round(time.Millisecond))
+	var limits []string
+	for name, values := range resp.Header {
+		if isRateLimitHeader(name) {
+			limits = append(limits, name+"="+strings.Join(values, ","))
+		}
+	}
+	if len(limits) > 0 {
+		sort.Strings(limits)
+		t.logf(id, "   rate limits: %s", strings.Join(limits, " "))
+	}
+	t.logHeaders(id, resp.Header)
+	resp.Body = &debugBody{body: resp.Body, transport: t, id: id, started: started, secrets: secrets}
+	return resp, nil
+}
+
+// debugBody logs a response body line by line as it is read, which for a
+// stream shows each SSE event as it arrives.
+type debugBody struct {
+	body      io.ReadCloser
+	transport *debugTransport
+	id        int64
+	started   time.Time
+	secrets   []string
+	partial   []byte
+	lines     int
+	done      bool
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.partial = append(b.partial, p[:n]...)
+	for {
+		newline := bytes.IndexByte(b.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		b.logLine(b.partial[:newline])
+		b.partial = b.partial[newline+1:]
+	}
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *debugBody) logLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	b.lines++
+	b.transport.logf(b.id, "   « %s", redact(string(line), b.secrets))
+}
+
+func (b *debugBody) finish(err error) {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.logLine(b.partial)
+	b.partial = nil
+	elapsed := time.Since(b.started).Round(time.Millisecond)
+	if err != nil && err != io.EOF {
+		b.transport.logf(b.id, "✗ body failed after %d lines, %s: %v", b.lines, elapsed, err)
+		return
+	}
+	b.transport.logf(b.id, "■ end of body, %d lines, %s", b.lines, elapsed)
+}
+
+func (b *debugBody) Close() error {
+	if !b.done {
+		b.finish(nil)
+	}
+	return b.body.Close()
+}
@@ -0,0 +1,125 @@
+package yuzu
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+// syncBuffer is a bytes.Buffer safe to share with the HTTP client.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDebugLogsTraffic(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	var log syncBuffer
+	chat.SetDebug(&log)
+	if !chat.Debugging() {
+		t.Fatal("debug mode not reported")
+	}
+	fake.Enqueue(fakeprovider.Reply{
+		Chunks:  []string{"hi ", "there"},
+		Headers: map[string]string{"X-Ratelimit-Remaining-Requests": "9", "Retry-After": "1"},
+	})
+	if _, err := chat.Stream(context.Background(), "hello", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	output := log.String()
+	for _, want := range []string{
+		"→ ",
+		"POST " + fake.BaseURL() + "/chat/completions",
+		"Authorization: [REDACTED]",
+		`"content": "hello"`,
+		"200 OK",
+		"rate limits: Retry-After=1 X-Ratelimit-Remaining-Requests=9",
+		`« data: {"choices":[{"delta":{"content":"there"}`,
+		"« data: [DONE]",
+		"■ end of body",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("debug log lacks %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "test-key") {
+		t.Errorf("debug log contains the API key:\n%s", output)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, "[#") {
+			t.Errorf("line without a request number: %q", line)
+		}
+	}
+
+	chat.SetDebug(nil)
+	before := log.String()
+	if _, err := chat.Send(context.Background(), "quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if log.String() != before {
+		t.Error("traffic logged after debug was turned off")
+	}
+}
+
+func TestDebugLogsNetworkErrors(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	var log syncBuffer
+	chat.SetDebug(&log)
+	fake.Close()
+	chat.Send(context.Background(), "hello")
+	if !strings.Contains(log.String(), "✗ ") {
+		t.Errorf("network error not logged:\n%s", log.String())
+	}
+}
+
+func TestRotatingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	log, err := OpenRotatingLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := log.(*rotatingFile)
+	file.maxBytes = 100
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 12; i++ {
+		if _, err := log.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("%s missing: %v", name, err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("%s is %d bytes, over the limit", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".4"); !os.IsNotExist(err) {
+		t.Errorf("kept more than %d old logs", logKeep)
+	}
+}
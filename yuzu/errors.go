@@ -0,0 +1,156 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds. Failures wrap one of these, so callers can tell them apart
+// with errors.Is.
+var (
+	ErrAuth                = errors.New("authentication failed")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrQuotaExceeded       = errors.New("quota or credit exhausted")
+	ErrContextLength       = errors.New("context length exceeded")
+	ErrProviderUnavailable = errors.New("provider unavailable")
+	ErrNetwork             = errors.New("network error")
+	ErrTimeout             = errors.New("timed out")
+	ErrParse               = errors.New("unreadable response")
+	ErrBadRequest          = errors.New("request rejected")
+	ErrInvalidReply        = errors.New("reply failed validation")
+	ErrNotFound            = errors.New("not found")
+	ErrStorage             = errors.New("storage failed")
+	ErrInUse               = errors.New("in use by another yuzuchat")
+)
+
+// ProviderError is a failed request to a provider. Kind is one of the error
+// kinds above; Message is the provider's own explanation when it sent one.
+type ProviderError struct {
+	Kind       error
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %v", e.Provider, e.Kind)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " (HTTP %d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	} else if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *ProviderError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// networkError wraps a failed exchange, telling a provider timeout apart
+// from a broken connection.
+func networkError(providerName string, err error) *ProviderError {
+	if errors.Is(err, ErrTimeout) {
+		return &ProviderError{Kind: ErrTimeout, Provider: providerName, Err: err}
+	}
+	return &ProviderError{Kind: ErrNetwork, Provider: providerName, Err: err}
+}
+
+func parseError(providerName string, err error) *ProviderError {
+	return &ProviderError{Kind: ErrParse, Provider: providerName, Err: err}
+}
+
+// responseError reads a non-200 response and classifies it from the status,
+// the error body and the Retry-After header.
+func responseError(providerName string, resp *http.Response) *ProviderError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	code, message := providerErrorMessage(body)
+	e := &ProviderError{
+		Provider:   providerName,
+		StatusCode: resp.StatusCode,
+		Code:       code,
+		Message:    message,
+		Kind:       classifyProviderError(resp.StatusCode, code, message),
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
+
+// providerErrorMessage extracts the code and message from the error bodies
+// providers send: OpenAI style {"error": {"message", "code"}}, a bare
+// {"error": "..."} or FastAPI's {"detail": "..."}. Anything else is returned
+// as raw text.
+func providerErrorMessage(body []byte) (string, string) {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Detail  json.RawMessage `json:"detail"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		for _, raw := range []json.RawMessage{parsed.Error, parsed.Detail} {
+			var text string
+			if json.Unmarshal(raw, &text) == nil && text != "" {
+				return "", text
+			}
+			var object struct {
+				Message string          `json:"message"`
+				Code    json.RawMessage `json:"code"`
+				Type    string          `json:"type"`
+			}
+			if json.Unmarshal(raw, &object) == nil && object.Message != "" {
+				code := strings.Trim(string(object.Code), `"`)
+				if code == "" || code == "null" {
+					code = object.Type
+				}
+				return code, object.Message
+			}
+		}
+		if parsed.Message != "" {
+			return "", parsed.Message
+		}
+	}
+	return "", strings.TrimSpace(string(body))
+}
+
+func containsAny(text string, words ...string) bool {
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyProviderError(status int, code, message string) error {
+	text := strings.ToLower(code + " " + message)
+	switch {
+	case status == 401 || status == 403:
+		return ErrAuth
+	case containsAny(text, "context_length", "context length", "maximum context", "context window", "too many tokens", "reduce the length", "prompt is too long"):
+		return ErrContextLength
+	case status == 402 || containsAny(text, "insufficient_quota", "quota", "credit", "billing"):
+		return ErrQuotaExceeded
+	case status == 429:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrProviderUnavailable
+	}
+	return ErrBadRequest
+}
@@ -0,0 +1,70 @@
+package yuzu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProviderErrorMessage(t *testing.T) {
+	tests := []struct {
+		body    string
+		code    string
+		message string
+	}{
+		{`{"error":{"message":"Invalid key","code":"invalid_api_key"}}`, "invalid_api_key", "Invalid key"},
+		{`{"error":{"message":"Too many","code":429}}`, "429", "Too many"},
+		{`{"error":{"message":"Out of quota","type":"insufficient_quota","code":null}}`, "insufficient_quota", "Out of quota"},
+		{`{"error":"model not found"}`, "", "model not found"},
+		{`{"detail":"Invalid token"}`, "", "Invalid token"},
+		{`{"message":"bare message"}`, "", "bare message"},
+		{"<html>Bad Gateway</html>\n", "", "<html>Bad Gateway</html>"},
+	}
+	for _, tt := range tests {
+		code, message := providerErrorMessage([]byte(tt.body))
+		if code != tt.code || message != tt.message {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.body, code, message, tt.code, tt.message)
+		}
+	}
+}
+
+func TestClassifyProviderError(t *testing.T) {
+	tests := []struct {
+		status  int
+		code    string
+		message string
+		want    error
+	}{
+		{401, "", "", ErrAuth},
+		{403, "", "quota exceeded", ErrAuth},
+		{400, "context_length_exceeded", "", ErrContextLength},
+		{413, "", "Prompt is too long", ErrContextLength},
+		{402, "", "", ErrQuotaExceeded},
+		{429, "insufficient_quota", "", ErrQuotaExceeded},
+		{429, "", "Rate limit reached", ErrRateLimited},
+		{500, "", "", ErrProviderUnavailable},
+		{503, "", "overloaded", ErrProviderUnavailable},
+		{400, "", "invalid temperature", ErrBadRequest},
+		{404, "", "no such model", ErrBadRequest},
+	}
+	for _, tt := range tests {
+		if got := classifyProviderError(tt.status, tt.code, tt.message); got != tt.want {
+			t.Errorf("classify(%d, %q, %q) = %v, want %v", tt.status, tt.code, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestProviderErrorUnwrap(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := error(networkError("chutes", cause))
+	if !errors.Is(err, ErrNetwork) || !errors.Is(err, cause) {
+		t.Errorf("%v does not wrap both its kind and its cause", err)
+	}
+	if !strings.Contains(err.Error(), "chutes") || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	withStatus := &ProviderError{Kind: ErrRateLimited, Provider: "openrouter", StatusCode: 429, Message: "slow down"}
+	if got := withStatus.Error(); got != "openrouter: rate limited (HTTP 429): slow down" {
+		t.Errorf("Error() = %q", got)
+	}
+}
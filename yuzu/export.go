@@ -0,0 +1,227 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+)
+
+// ExportHistory writes conversations to path as md, html, jsonl or txt and
+// returns the number of messages written. Without a date range the whole
+// current branch is exported from the archive, not just the window kept for
+// the model. With one, every archived message in the range is exported,
+// grouped by session, whichever session is current. A zero from or to
+// leaves that end of the range open.
+func (y *YuzuChat) ExportHistory(format, path string, from, to time.Time) (int, error) {
+	var sessions [][]Message
+	if from.IsZero() && to.IsZero() {
+		conversation, err := y.fullConversation()
+		if err != nil {
+			return 0, fmt.Errorf("reading archive: %w", err)
+		}
+		if len(conversation) > 0 {
+			sessions = [][]Message{conversation}
+		}
+	} else {
+		archive, err := y.loadArchive()
+		if err != nil {
+			return 0, fmt.Errorf("reading archive: %w", err)
+		}
+		sessions = groupBySession(filterMessagesByDate(archive, from, to))
+	}
+	count := 0
+	for _, messages := range sessions {
+		count += len(messages)
+	}
+	if count == 0 {
+		return 0, errors.New("no messages to export")
+	}
+	var output string
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		output = renderMarkdown(sessions)
+	case "html":
+		output = renderHTML(sessions)
+	case "jsonl":
+		data, err := renderJSONL(y.expandPromptVariables(y.activeSystemPrompt()), sessions)
+		if err != nil {
+			return 0, fmt.Errorf("marshaling export: %w", err)
+		}
+		output = data
+	case "txt", "text":
+		output = renderText(sessions)
+	default:
+		return 0, fmt.Errorf("unknown export format '%s', use md, html, jsonl or txt", format)
+	}
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return 0, fmt.Errorf("writing export: %w", err)
+	}
+	return count, nil
+}
+
+// groupBySession splits messages by session, keeping the sessions in the
+// order they first appear.
+func groupBySession(messages []Message) [][]Message {
+	var sessions [][]Message
+	index := map[string]int{}
+	for _, msg := range messages {
+		i, seen := index[msg.Session]
+		if !seen {
+			i = len(sessions)
+			index[msg.Session] = i
+			sessions = append(sessions, nil)
+		}
+		sessions[i] = append(sessions[i], msg)
+	}
+	return sessions
+}
+
+// fullConversation returns the current branch from its first message, which
+// the archive keeps after trimHistory has dropped it from the window. Older
+// archives without message IDs fall back to the window.
+func (y *YuzuChat) fullConversation() ([]Message, error) {
+	archive, err := y.loadArchive()
+	if err != nil {
+		return nil, err
+	}
+	path := buildMessageTree(archive, y.sessionID).pathTo(lastMessageID(y.conversationHistory))
+	if len(path) < len(y.conversationHistory) {
+		return y.conversationHistory, nil
+	}
+	return path, nil
+}
+
+func filterMessagesByDate(messages []Message, from, to time.Time) []Message {
+	if from.IsZero() && to.IsZero() {
+		return messages
+	}
+	var filtered []Message
+	for _, msg := range messages {
+		ts, err := time.Parse(time.RFC3339, msg.Timestamp)
+		if err != nil {
+			continue
+		}
+		if !from.IsZero() && ts.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !ts.Before(to) {
+			continue
+		}
+		filtered = append(filtered, msg)
+	}
+	return filtered
+}
+
+func roleTitle(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	}
+	return role
+}
+
+// renderMarkdown heads each message with its role, and each session with its
+// ID when there is more than one.
+func renderMarkdown(sessions [][]Message) string {
+	var b strings.Builder
+	b.WriteString("# YuzuChat Conversation\n\n")
+	heading := "##"
+	for _, messages := range sessions {
+		if len(sessions) > 1 {
+			fmt.Fprintf(&b, "## Session %s\n\n", messages[0].Session)
+			heading = "###"
+		}
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "%s %s\n\n", heading, roleTitle(msg.Role))
+			fmt.Fprintf(&b, "_%s · %s/%s_\n\n", msg.Timestamp, msg.Provider, msg.Model)
+			b.WriteString(msg.Content)
+			b.WriteString("\n\n")
+		}
+	}
+	return b.String()
+}
+
+const exportHTMLStyle = `body{font-family:-apple-system,"Segoe UI",sans-serif;max-width:820px;margin:2em auto;padding:0 1em;background:#fffaf0;color:#222}
+h1{color:#e07b00}
+.msg{border-radius:8px;padding:.8em 1em;margin:1em 0}
+.user{background:#fff1d6}
+.assistant{background:#eef6ff}
+.system{background:#f0f0f0}
+.meta{font-size:.8em;color:#777;margin-bottom:.4em}
+.content{white-space:pre-wrap;word-wrap:break-word}`
+
+func renderHTML(sessions [][]Message) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>YuzuChat Conversation</title>\n")
+	fmt.Fprintf(&b, "<style>\n%s\n</style>\n</head>\n<body>\n<h1>🍊 YuzuChat Conversation</h1>\n", exportHTMLStyle)
+	for _, messages := range sessions {
+		if len(sessions) > 1 {
+			fmt.Fprintf(&b, "<h2>Session %s</h2>\n", html.EscapeString(messages[0].Session))
+		}
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "<div class=\"msg %s\">\n", html.EscapeString(msg.Role))
+			fmt.Fprintf(&b, "<div class=\"meta\"><strong>%s</strong> · %s · %s/%s</div>\n",
+				html.EscapeString(roleTitle(msg.Role)), html.EscapeString(msg.Timestamp),
+				html.EscapeString(msg.Provider), html.EscapeString(msg.Model))
+			fmt.Fprintf(&b, "<div class=\"content\">%s</div>\n</div>\n", html.EscapeString(msg.Content))
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// renderJSONL emits each session as one OpenAI fine-tuning record.
+func renderJSONL(systemPrompt string, sessions [][]Message) (string, error) {
+	type chatMessage struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	var b strings.Builder
+	for _, messages := range sessions {
+		record := struct {
+			Messages []chatMessage `json:"messages"`
+		}{}
+		if systemPrompt != "" {
+			record.Messages = append(record.Messages, chatMessage{Role: "system", Content: systemPrompt})
+		}
+		for _, msg := range messages {
+			record.Messages = append(record.Messages, chatMessage{Role: msg.Role, Content: msg.Content})
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+		b.Write(data)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+func renderText(sessions [][]Message) string {
+	var b strings.Builder
+	for _, messages := range sessions {
+		if len(sessions) > 1 {
+			fmt.Fprintf(&b, "=== Session %s ===\n\n", messages[0].Session)
+		}
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "[%s] %s (%s/%s):\n%s\n\n", msg.Timestamp, roleTitle(msg.Role), msg.Provider, msg.Model, msg.Content)
+		}
+	}
+	return b.String()
+}
+
+// ParseDateArg accepts YYYY-MM-DD or RFC3339.
+func ParseDateArg(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,89 @@
+package yuzu
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestExportHistoryBeyondWindow(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	for i := 1; i <= 15; i++ {
+		if _, err := chat.Send(context.Background(), fmt.Sprintf("question %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(chat.History()) >= 30 {
+		t.Fatalf("window holds %d messages, the test needs it trimmed", len(chat.History()))
+	}
+	n, err := chat.ExportHistory("md", "export.md", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("export.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 30 || !strings.Contains(string(data), "question 1\n") || !strings.Contains(string(data), "echo: question 15") {
+		t.Errorf("exported %d messages:\n%s", n, data)
+	}
+
+	if n, err := chat.ExportHistory("txt", "future.txt", time.Now().Add(time.Hour), time.Time{}); err == nil {
+		t.Errorf("exported %d messages from the future", n)
+	}
+	n, err = chat.ExportHistory("jsonl", "today.jsonl", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || n != 30 {
+		t.Errorf("date range export: %d messages, err %v", n, err)
+	}
+}
+
+func TestExportDateRangeCoversAllSessions(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if _, err := chat.Send(context.Background(), "in the first session"); err != nil {
+		t.Fatal(err)
+	}
+	first := chat.SessionID()
+	if err := chat.ClearHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "in the second session"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := chat.ExportHistory("md", "current.md", time.Time{}, time.Time{})
+	if err != nil || n != 2 {
+		t.Fatalf("current session export: %d messages, err %v", n, err)
+	}
+
+	n, err = chat.ExportHistory("md", "today.md", time.Now().Add(-time.Hour), time.Time{})
+	if err != nil || n != 4 {
+		t.Fatalf("date range export: %d messages, err %v", n, err)
+	}
+	data, err := os.ReadFile("today.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"## Session " + first, "## Session " + chat.SessionID(), "in the first session", "echo: in the second session"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("export lacks %q:\n%s", want, data)
+		}
+	}
+
+	if _, err := chat.ExportHistory("jsonl", "today.jsonl", time.Now().Add(-time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile("today.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("JSONL export has %d records, want one per session:\n%s", lines, data)
+	}
+}
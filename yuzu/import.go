@@ -0,0 +1,293 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportHistory converts a conversation exported by another client into
+// Messages. With newSession the current history is replaced, otherwise the
+// imported messages are appended to it. It returns how many were imported.
+// Files holding several conversations take a selector: part of the title for
+// ChatGPT, the record number for JSONL.
+func (y *YuzuChat) ImportHistory(format, path string, newSession bool, selector string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var messages []Message
+	switch strings.ToLower(format) {
+	case "chatgpt":
+		messages, err = parseChatGPTExport(data, selector)
+	case "jsonl", "openai":
+		messages, err = parseOpenAIJSONL(data, selector)
+	case "sillytavern", "st":
+		messages, err = parseSillyTavern(data)
+	default:
+		return 0, fmt.Errorf("unknown import format '%s', use chatgpt, jsonl or sillytavern", format)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(messages) == 0 {
+		return 0, errors.New("no messages found to import")
+	}
+	if newSession {
+		y.conversationHistory = []Message{}
+		y.sessionID = newSessionID()
+	}
+	for i := range messages {
+		messages[i].Session = y.sessionID
+	}
+	linkMessages(messages, lastMessageID(y.conversationHistory))
+	y.conversationHistory = append(y.conversationHistory, messages...)
+	y.trimHistory()
+	if err := y.appendToArchive(messages...); err != nil {
+		return len(messages), err
+	}
+	return len(messages), y.saveHistory()
+}
+
+// messageText flattens OpenAI-style content, which is either a plain string
+// or an array of typed parts, into text.
+func messageText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func unixTimestamp(seconds float64) string {
+	if seconds <= 0 {
+		return time.Now().Format(time.RFC3339)
+	}
+	sec := int64(seconds)
+	nsec := int64((seconds - float64(sec)) * 1e9)
+	return time.Unix(sec, nsec).Format(time.RFC3339)
+}
+
+// parseChatGPTExport reads ChatGPT's conversations.json. The conversation whose
+// title contains selector is used, or the most recent one if selector is empty.
+// Only the active branch (current_node back to the root) is imported.
+func parseChatGPTExport(data []byte, selector string) ([]Message, error) {
+	type chatGPTNode struct {
+		Parent  string `json:"parent"`
+		Message *struct {
+			Author struct {
+				Role string `json:"role"`
+			} `json:"author"`
+			Content struct {
+				Parts []interface{} `json:"parts"`
+			} `json:"content"`
+			CreateTime float64 `json:"create_time"`
+			Metadata   struct {
+				ModelSlug string `json:"model_slug"`
+			} `json:"metadata"`
+		} `json:"message"`
+	}
+	var conversations []struct {
+		Title       string                 `json:"title"`
+		UpdateTime  float64                `json:"update_time"`
+		CurrentNode string                 `json:"current_node"`
+		Mapping     map[string]chatGPTNode `json:"mapping"`
+	}
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, err
+	}
+	chosen := -1
+	for i, conv := range conversations {
+		if selector != "" {
+			if strings.Contains(strings.ToLower(conv.Title), strings.ToLower(selector)) {
+				chosen = i
+				break
+			}
+		} else if chosen == -1 || conv.UpdateTime > conversations[chosen].UpdateTime {
+			chosen = i
+		}
+	}
+	if chosen == -1 {
+		return nil, fmt.Errorf("no conversation matching '%s'", selector)
+	}
+	conv := conversations[chosen]
+	var messages []Message
+	for id := conv.CurrentNode; id != ""; id = conv.Mapping[id].Parent {
+		node, ok := conv.Mapping[id]
+		if !ok {
+			break
+		}
+		if node.Message == nil {
+			continue
+		}
+		role := node.Message.Author.Role
+		if role != "user" && role != "assistant" {
+			continue
+		}
+		var texts []string
+		for _, part := range node.Message.Content.Parts {
+			if text, ok := part.(string); ok && text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		messages = append(messages, Message{
+			Role:      role,
+			Content:   strings.Join(texts, "\n"),
+			Timestamp: unixTimestamp(node.Message.CreateTime),
+			Model:     node.Message.Metadata.ModelSlug,
+			Provider:  "chatgpt",
+		})
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// parseOpenAIJSONL reads lines holding either {"messages": [...]} or a bare
+// message array, each one conversation. Record number selector (from 1) is
+// imported; it may be left out when there is only one. System messages are
+// skipped since system.txt owns those.
+func parseOpenAIJSONL(data []byte, selector string) ([]Message, error) {
+	type openAIMessage struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	var records [][]openAIMessage
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var lineMessages []openAIMessage
+		if strings.HasPrefix(line, "[") {
+			if err := json.Unmarshal([]byte(line), &lineMessages); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+		} else {
+			var record struct {
+				Messages []openAIMessage `json:"messages"`
+			}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			lineMessages = record.Messages
+		}
+		records = append(records, lineMessages)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	chosen := 1
+	if selector != "" {
+		var err error
+		if chosen, err = strconv.Atoi(selector); err != nil || chosen < 1 || chosen > len(records) {
+			return nil, fmt.Errorf("no record %s, the file holds %d", selector, len(records))
+		}
+	} else if len(records) > 1 {
+		return nil, fmt.Errorf("the file holds %d conversations, give the number of the one to import (1-%d)", len(records), len(records))
+	}
+	now := time.Now().Format(time.RFC3339)
+	var messages []Message
+	for _, msg := range records[chosen-1] {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		messages = append(messages, Message{
+			Role:      msg.Role,
+			Content:   messageText(msg.Content),
+			Timestamp: now,
+			Provider:  "import",
+		})
+	}
+	return messages, nil
+}
+
+var sillyTavernDateLayouts = []string{
+	time.RFC3339,
+	"January 2, 2006 3:04pm",
+	"January 2, 2006 3:04 PM",
+	"2006-01-02 @15h 04m 05s 000ms",
+	"2006-01-02 @15h04m05s",
+}
+
+func parseSillyTavernDate(raw json.RawMessage) string {
+	var millis float64
+	if err := json.Unmarshal(raw, &millis); err == nil && millis > 0 {
+		return unixTimestamp(millis / 1000)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		for _, layout := range sillyTavernDateLayouts {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return t.Format(time.RFC3339)
+			}
+		}
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+// parseSillyTavern reads a SillyTavern .jsonl chat: a metadata header line
+// followed by one line per message.
+func parseSillyTavern(data []byte) ([]Message, error) {
+	var messages []Message
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var entry struct {
+			Name     string          `json:"name"`
+			IsUser   bool            `json:"is_user"`
+			IsSystem bool            `json:"is_system"`
+			SendDate json.RawMessage `json:"send_date"`
+			Mes      *string         `json:"mes"`
+			Extra    struct {
+				Model string `json:"model"`
+				API   string `json:"api"`
+			} `json:"extra"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if entry.Mes == nil || entry.IsSystem {
+			continue
+		}
+		role := "assistant"
+		if entry.IsUser {
+			role = "user"
+		}
+		provider := entry.Extra.API
+		if provider == "" {
+			provider = "sillytavern"
+		}
+		messages = append(messages, Message{
+			Role:      role,
+			Content:   *entry.Mes,
+			Timestamp: parseSillyTavernDate(entry.SendDate),
+			Model:     entry.Extra.Model,
+			Provider:  provider,
+		})
+	}
+	return messages, nil
+}
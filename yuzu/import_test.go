@@ -0,0 +1,93 @@
+package yuzu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestImportFormats(t *testing.T) {
+	tests := []struct {
+		format   string
+		file     string
+		selector string
+		want     []string // role: content
+		model    string   // of the last message
+		wantErr  string
+	}{
+		{"chatgpt", "chatgpt.json", "", []string{"user: How do I make pancakes?", "assistant: Flour, eggs, milk."}, "gpt-4o-mini", ""},
+		{"chatgpt", "chatgpt.json", "black", []string{"user: What is a black hole?", "assistant: A region where gravity\ntraps light."}, "gpt-4o", ""},
+		{"chatgpt", "chatgpt.json", "weather", nil, "", "no conversation matching 'weather'"},
+		{"jsonl", "openai.jsonl", "1", []string{"user: Capital of France?", "assistant: Paris."}, "", ""},
+		{"jsonl", "openai.jsonl", "2", []string{"user: Describe this", "assistant: A cat."}, "", ""},
+		{"jsonl", "openai.jsonl", "3", []string{"user: 2+2?", "assistant: 4", "user: And 3+3?", "assistant: 6"}, "", ""},
+		{"jsonl", "openai.jsonl", "", nil, "", "holds 3 conversations"},
+		{"jsonl", "openai.jsonl", "4", nil, "", "no record 4"},
+		{"openai", "single.jsonl", "", []string{"user: Hello", "assistant: Hi there."}, "", ""},
+		{"sillytavern", "sillytavern.jsonl", "", []string{"assistant: Hello! I'm Yuzu.", "user: Hi Yuzu, how are you?", "assistant: Doing great."}, "gpt-4o", ""},
+	}
+	for _, tt := range tests {
+		path, err := filepath.Abs(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := tt.format + " " + tt.file + " " + tt.selector
+		t.Run(name, func(t *testing.T) {
+			chat := newTestChat(t, fakeprovider.New(t))
+			n, err := chat.ImportHistory(tt.format, path, true, tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %d messages, %v; want an error containing %q", n, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			history := chat.History()
+			var got []string
+			for _, msg := range history {
+				got = append(got, msg.Role+": "+msg.Content)
+			}
+			if n != len(tt.want) || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("imported %d messages %q, want %q", n, got, tt.want)
+			}
+			if model := history[len(history)-1].Model; model != tt.model {
+				t.Errorf("model = %q, want %q", model, tt.model)
+			}
+			for i, msg := range history {
+				if msg.Session != history[0].Session {
+					t.Errorf("message %d in session %s, want %s", i, msg.Session, history[0].Session)
+				}
+				if i > 0 && msg.ParentID != history[i-1].ID {
+					t.Errorf("message %d parented on %q, want %q", i, msg.ParentID, history[i-1].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestImportAppendsToCurrentSession(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("testdata", "single.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := newTestChat(t, fakeprovider.New(t))
+	if _, err := chat.ImportHistory("jsonl", path, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	session := chat.SessionID()
+	if _, err := chat.ImportHistory("jsonl", path, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	history := chat.History()
+	if len(history) != 4 || history[3].Session != session || history[2].ParentID != history[1].ID {
+		t.Errorf("history after two imports = %+v", history)
+	}
+	if _, err := chat.ImportHistory("jsonl", filepath.Join(t.TempDir(), "missing.jsonl"), false, ""); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
@@ -0,0 +1,415 @@
+package yuzu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultJSONRetries = 2
+
+// ResponseSchema is a JSON Schema that replies must satisfy, loaded from a
+// bare schema file or an OpenAI style {"name", "schema", "strict"} wrapper.
+type ResponseSchema struct {
+	Name   string
+	Strict bool
+	Schema map[string]interface{}
+}
+
+var schemaNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+func LoadResponseSchema(path string) (*ResponseSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON object: %v", path, err)
+	}
+	schema := &ResponseSchema{Schema: raw}
+	if inner, ok := raw["schema"].(map[string]interface{}); ok {
+		schema.Schema = inner
+		schema.Name, _ = raw["name"].(string)
+		schema.Strict, _ = raw["strict"].(bool)
+	}
+	if schema.Name == "" {
+		schema.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	schema.Name = schemaNameInvalidChars.ReplaceAllString(schema.Name, "_")
+	return schema, nil
+}
+
+// SetJSONMode turns JSON replies on or off.
+func (y *YuzuChat) SetJSONMode(enabled bool) {
+	y.jsonMode = enabled
+}
+
+// JSONMode reports whether replies must be valid JSON.
+func (y *YuzuChat) JSONMode() bool {
+	return y.jsonMode
+}
+
+// SetSchema makes replies validate against schema; nil removes it.
+func (y *YuzuChat) SetSchema(schema *ResponseSchema) {
+	y.schema = schema
+}
+
+// SetJSONRetries sets how often an invalid JSON reply is sent back to the
+// model before giving up.
+func (y *YuzuChat) SetJSONRetries(n int) {
+	y.jsonRetries = n
+}
+
+func (y *YuzuChat) wantsJSON() bool {
+	return y.jsonMode || y.schema != nil
+}
+
+// responseFormat picks the strictest response_format the provider accepts,
+// or nil when JSON is off or the provider supports none.
+func (y *YuzuChat) responseFormat(provider *AIProvider) map[string]interface{} {
+	switch {
+	case y.schema != nil && contains(provider.ResponseFormats, "json_schema"):
+		jsonSchema := map[string]interface{}{"name": y.schema.Name, "schema": y.schema.Schema}
+		if y.schema.Strict {
+			jsonSchema["strict"] = true
+		}
+		return map[string]interface{}{"type": "json_schema", "json_schema": jsonSchema}
+	case y.wantsJSON() && contains(provider.ResponseFormats, "json_object"):
+		return map[string]interface{}{"type": "json_object"}
+	}
+	return nil
+}
+
+// jsonInstruction is added to the system prompt in JSON mode. Providers
+// without response_format rely on it entirely, and json_object mode
+// requires the prompt to mention JSON anyway.
+func (y *YuzuChat) jsonInstruction() string {
+	if !y.wantsJSON() {
+		return ""
+	}
+	instruction := "Reply with a single JSON value only, with no prose and no code fences."
+	if y.schema != nil {
+		schema, _ := json.MarshalIndent(y.schema.Schema, "", "  ")
+		instruction += " It must be valid against this JSON Schema:\n" + string(schema)
+	}
+	return instruction
+}
+
+// checkJSONReply parses reply, tolerating a surrounding code fence, and
+// validates it against the schema. It returns the bare JSON and any problems.
+func (y *YuzuChat) checkJSONReply(reply string) (string, []string) {
+	cleaned := strings.TrimSpace(reply)
+	if strings.HasPrefix(cleaned, "```") && strings.HasSuffix(cleaned, "```") {
+		cleaned = strings.TrimSuffix(cleaned, "```")
+		if newline := strings.Index(cleaned, "\n"); newline >= 0 {
+			cleaned = strings.TrimSpace(cleaned[newline+1:])
+		}
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(cleaned), &value); err != nil {
+		return cleaned, []string{fmt.Sprintf("reply is not valid JSON: %v", err)}
+	}
+	if y.schema == nil {
+		return cleaned, nil
+	}
+	return cleaned, validateJSONSchema(y.schema.Schema, value)
+}
+
+// structuredReply requests a non-streamed reply. In JSON mode a reply that
+// does not parse or match the schema is sent back with the problems found,
+// up to jsonRetries times, and only a valid reply is returned.
+func (y *YuzuChat) structuredReply(ctx context.Context, providerName, model string, messages []map[string]string) (completion, error) {
+	var total Usage
+	messages = append([]map[string]string{}, messages...)
+	for attempt := 0; ; attempt++ {
+		req, err := y.newChatRequest(providerName, model, messages, false)
+		if err != nil {
+			return completion{Usage: total}, fmt.Errorf("request creation failed: %w", err)
+		}
+		reply, err := y.requestReply(providerName, req.WithContext(ctx))
+		total.PromptTokens += reply.Usage.PromptTokens
+		total.CompletionTokens += reply.Usage.CompletionTokens
+		total.TotalTokens += reply.Usage.TotalTokens
+		reply.Usage = total
+		if err != nil || !y.wantsJSON() {
+			return reply, err
+		}
+		cleaned, problems := y.checkJSONReply(reply.Content)
+		if len(problems) == 0 {
+			reply.Content = cleaned
+			return reply, nil
+		}
+		if reply.FinishReason == "length" {
+			problems = append(problems, "the reply was cut off at the token limit; keep it shorter")
+		}
+		if attempt >= y.jsonRetries {
+			return completion{Usage: total}, fmt.Errorf("%w after %d retries:\n  - %s", ErrInvalidReply, attempt, strings.Join(problems, "\n  - "))
+		}
+		y.log(ctx).Warn("reply failed JSON validation, asking again", "attempt", attempt+1, "problems", problems)
+		messages = append(messages,
+			map[string]string{"role": "assistant", "content": reply.Content},
+			map[string]string{"role": "user", "content": "Your reply was rejected:\n- " + strings.Join(problems, "\n- ") + "\nReply again with only the corrected JSON."},
+		)
+	}
+}
+
+// validateJSONSchema checks value against schema and describes every
+// violation with a JSONPath-like location. It covers the keywords structured
+// output schemas use: type, enum, const, properties, required,
+// additionalProperties, items, length and range bounds, pattern, allOf,
+// anyOf, oneOf and local $ref.
+func validateJSONSchema(schema map[string]interface{}, value interface{}) []string {
+	v := &schemaValidator{root: schema, following: map[[2]string]bool{}}
+	v.check(schema, value, "$")
+	return v.problems
+}
+
+type schemaValidator struct {
+	root     map[string]interface{}
+	problems []string
+	// following holds the $refs being followed, keyed by ref and path. A
+	// ref reached again at the same path loops without consuming any of
+	// the value, as {"$ref": "#"} does, and fails instead of recursing
+	// forever.
+	following map[[2]string]bool
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) matches(schema map[string]interface{}, value interface{}, path string) bool {
+	sub := &schemaValidator{root: v.root, following: v.following}
+	sub.check(schema, value, path)
+	return len(sub.problems) == 0
+}
+
+// resolveRef follows a "#/..." JSON pointer within the root schema.
+func (v *schemaValidator) resolveRef(ref string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	var node interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	schema, ok := node.(map[string]interface{})
+	return schema, ok
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func typeMatches(want string, value interface{}) bool {
+	got := jsonType(value)
+	if want == "integer" {
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	}
+	return want == got
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func (v *schemaValidator) check(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, found := v.resolveRef(ref)
+		if !found {
+			v.fail(path, "unresolvable $ref %q", ref)
+			return
+		}
+		key := [2]string{ref, path}
+		if v.following[key] {
+			v.fail(path, "circular $ref %q", ref)
+			return
+		}
+		v.following[key] = true
+		v.check(target, value, path)
+		delete(v.following, key)
+		return
+	}
+	if types, ok := schema["type"]; ok {
+		var allowed []string
+		switch t := types.(type) {
+		case string:
+			allowed = []string{t}
+		case []interface{}:
+			for _, item := range t {
+				if name, ok := item.(string); ok {
+					allowed = append(allowed, name)
+				}
+			}
+		}
+		matched := false
+		for _, want := range allowed {
+			if typeMatches(want, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "expected %s, got %s", strings.Join(allowed, " or "), jsonType(value))
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if reflect.DeepEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			options, _ := json.Marshal(enum)
+			v.fail(path, "must be one of %s", options)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		expected, _ := json.Marshal(constant)
+		v.fail(path, "must equal %s", expected)
+	}
+	for _, sub := range schemaList(schema["allOf"]) {
+		v.check(sub, value, path)
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 {
+		matched := false
+		for _, sub := range anyOf {
+			if v.matches(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "does not match any of the anyOf schemas")
+		}
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 {
+		count := 0
+		for _, sub := range oneOf {
+			if v.matches(sub, value, path) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(path, "matches %d of the oneOf schemas, expected exactly 1", count)
+		}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.checkObject(schema, value, path)
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(value)) < n {
+			v.fail(path, "has %d items, expected at least %.0f", len(value), n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(value)) > n {
+			v.fail(path, "has %d items, expected at most %.0f", len(value), n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				v.check(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if n, ok := schemaNumber(schema, "minLength"); ok && float64(length) < n {
+			v.fail(path, "is %d characters, expected at least %.0f", length, n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && float64(length) > n {
+			v.fail(path, "is %d characters, expected at most %.0f", length, n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				v.fail(path, "does not match pattern %q", pattern)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && value < n {
+			v.fail(path, "is %v, expected at least %v", value, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && value > n {
+			v.fail(path, "is %v, expected at most %v", value, n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && value <= n {
+			v.fail(path, "is %v, expected more than %v", value, n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && value >= n {
+			v.fail(path, "is %v, expected less than %v", value, n)
+		}
+	}
+}
+
+func (v *schemaValidator) checkObject(schema map[string]interface{}, value map[string]interface{}, path string) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if key, ok := name.(string); ok {
+			if _, present := value[key]; !present {
+				v.fail(path, "missing required property %q", key)
+			}
+		}
+	}
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			v.check(property, value[key], childPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "unexpected property %q", key)
+			}
+		case map[string]interface{}:
+			v.check(additional, value[key], childPath)
+		}
+	}
+}
+
+func schemaList(raw interface{}) []map[string]interface{} {
+	items, _ := raw.([]interface{})
+	var schemas []map[string]interface{}
+	for _, item := range items {
+		if schema, ok := item.(map[string]interface{}); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
@@ -0,0 +1,199 @@
+package yuzu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {"tag": {"enum": ["a", "b"]}}
+}`
+
+func TestValidateJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(personSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`{"name": "Yuzu", "age": 3, "tags": ["a"]}`, nil},
+		{`{"name": "Yuzu"}`, []string{`$: missing required property "age"`}},
+		{`{"name": "", "age": 1.5}`, []string{"$.age: expected integer, got number", "$.name: is 0 characters, expected at least 1"}},
+		{`{"name": "x", "age": -1, "extra": true}`, []string{"$.age: is -1, expected at least 0", `$: unexpected property "extra"`}},
+		{`{"name": "x", "age": 1, "tags": ["a", "c", "b"]}`, []string{"$.tags: has 3 items, expected at most 2", `$.tags[1]: must be one of ["a","b"]`}},
+		{`[1]`, []string{"$: expected object, got array"}},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		got := validateJSONSchema(schema, value)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateJSONSchemaCombinators(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(`{"oneOf": [{"type": "string", "pattern": "^[a-z]+$"}, {"type": "number", "exclusiveMaximum": 10}]}`), &schema)
+	for value, valid := range map[string]bool{`"abc"`: true, `5`: true, `"ABC"`: false, `10`: false, `null`: false} {
+		var decoded interface{}
+		json.Unmarshal([]byte(value), &decoded)
+		if problems := validateJSONSchema(schema, decoded); (len(problems) == 0) != valid {
+			t.Errorf("%s: problems %q, want valid=%v", value, problems, valid)
+		}
+	}
+}
+
+func TestValidateJSONSchemaCircularRef(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  string
+		valid  bool
+	}{
+		{`{"$ref": "#"}`, `1`, false},
+		{`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`, `1`, false},
+		{`{"anyOf": [{"$ref": "#"}, {"$ref": "#"}]}`, `1`, false},
+		// A recursive schema is fine as long as the value it walks ends.
+		{`{"type": "object", "properties": {"child": {"$ref": "#"}}}`, `{"child": {"child": {}}}`, true},
+	}
+	for _, tt := range tests {
+		var schema map[string]interface{}
+		var value interface{}
+		json.Unmarshal([]byte(tt.schema), &schema)
+		json.Unmarshal([]byte(tt.value), &value)
+		problems := validateJSONSchema(schema, value)
+		if (len(problems) == 0) != tt.valid {
+			t.Errorf("%s against %s: problems %q, want valid=%v", tt.value, tt.schema, problems, tt.valid)
+		}
+	}
+}
+
+func TestLoadResponseSchema(t *testing.T) {
+	dir := t.TempDir()
+	bare := filepath.Join(dir, "my person.json")
+	wrapped := filepath.Join(dir, "wrapped.json")
+	writeFile(t, bare, personSchema)
+	writeFile(t, wrapped, `{"name": "person", "strict": true, "schema": `+personSchema+`}`)
+
+	schema, err := LoadResponseSchema(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Name != "my_person" || schema.Strict || schema.Schema["type"] != "object" {
+		t.Errorf("bare schema loaded as %+v", schema)
+	}
+	schema, err = LoadResponseSchema(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Name != "person" || !schema.Strict || schema.Schema["type"] != "object" {
+		t.Errorf("wrapped schema loaded as %+v", schema)
+	}
+}
+
+func TestStructuredReplyRetries(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	schema, err := LoadResponseSchema(writeSchema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat.SetSchema(schema)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "Sure! Here it is"},
+		fakeprovider.Reply{Content: `{"name": "Yuzu"}`},
+		fakeprovider.Reply{Content: "```json\n{\"name\": \"Yuzu\", \"age\": 3}\n```"},
+	)
+
+	resp, err := chat.AskOnce(context.Background(), "invent a person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != `{"name": "Yuzu", "age": 3}` {
+		t.Errorf("content = %q", resp.Content)
+	}
+	requests := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("made %d requests, want 3", len(requests))
+	}
+	format, _ := requests[0].Body["response_format"].(map[string]interface{})
+	if format["type"] != "json_schema" {
+		t.Errorf("response_format = %v", requests[0].Body["response_format"])
+	}
+	if !strings.Contains(requests[0].Messages[0].Content, "JSON Schema") {
+		t.Errorf("system prompt lacks the schema: %q", requests[0].Messages[0].Content)
+	}
+	if last := requests[2].LastMessage(); !strings.Contains(last, `missing required property "age"`) {
+		t.Errorf("validation errors not sent back: %q", last)
+	}
+}
+
+func TestStreamValidatesJSON(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetJSONMode(true)
+	fake.Enqueue(
+		fakeprovider.Reply{Chunks: []string{"Sure, ", "here"}},
+		fakeprovider.Reply{Content: `{"ok": true}`},
+	)
+	var deltas []string
+	resp, err := chat.Stream(context.Background(), "status?", func(delta string) { deltas = append(deltas, delta) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != `{"ok": true}` || len(deltas) != 1 || deltas[0] != resp.Content {
+		t.Errorf("content %q, deltas %q", resp.Content, deltas)
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("made %d requests, want a retry after the invalid reply", n)
+	}
+}
+
+func TestStructuredReplyGivesUp(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetJSONMode(true)
+	chat.SetJSONRetries(1)
+	fake.Enqueue(fakeprovider.Reply{Content: "nope"}, fakeprovider.Reply{Content: "still no"})
+
+	_, err := chat.Send(context.Background(), "json please")
+	if !errors.Is(err, ErrInvalidReply) {
+		t.Fatalf("got %v, want ErrInvalidReply", err)
+	}
+	if len(fake.Requests()) != 2 {
+		t.Errorf("made %d requests, want 2", len(fake.Requests()))
+	}
+	format, _ := fake.LastRequest().Body["response_format"].(map[string]interface{})
+	if format["type"] != "json_object" {
+		t.Errorf("response_format = %v", format)
+	}
+	if len(chat.History()) != 0 {
+		t.Errorf("invalid reply was added to the history: %+v", chat.History())
+	}
+}
+
+func writeSchema(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "person.json")
+	writeFile(t, path, personSchema)
+	return path
+}
@@ -0,0 +1,167 @@
+package yuzu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SetAPIKey checks apiKey against the provider and saves it unless the
+// provider rejects it. The check is returned either way.
+func (y *YuzuChat) SetAPIKey(providerName, apiKey string) (KeyCheck, error) {
+	if apiKey == "" {
+		return KeyCheck{}, errors.New("API key cannot be empty")
+	}
+	provider, exists := y.providers[providerName]
+	if !exists {
+		return KeyCheck{}, fmt.Errorf("provider '%s' %w", providerName, ErrNotFound)
+	}
+	check := y.validateAPIKey(providerName, apiKey)
+	if check.Status == "invalid" {
+		return check, &ProviderError{Kind: ErrAuth, Provider: providerName, Message: "key rejected (" + check.Detail + "), not saved"}
+	}
+	if err := y.saveKeyFile(provider.KeyFile, apiKey); err != nil {
+		return check, fmt.Errorf("saving API key: %w", err)
+	}
+	provider.APIKey = apiKey
+	provider.IsEnabled = true
+	return check, nil
+}
+
+// validateAPIKey makes a cheap authenticated call against the provider's
+// CheckURL so that a mistyped key shows up now rather than on the next chat.
+// A chat completions CheckURL is sent an empty request, so no tokens are
+// spent. That only tells a rejected key apart: an API may well turn away a
+// malformed request before it looks at the key, so any other answer leaves
+// the key unverified.
+func (y *YuzuChat) validateAPIKey(providerName, apiKey string) KeyCheck {
+	check := KeyCheck{Provider: providerName, Status: "unknown"}
+	provider, exists := y.providers[providerName]
+	if !exists || provider.CheckURL == "" {
+		check.Detail = "no check endpoint"
+		return check
+	}
+	method, body := "GET", io.Reader(nil)
+	emptyChat := strings.HasSuffix(provider.CheckURL, "/chat/completions")
+	if emptyChat {
+		method, body = "POST", strings.NewReader("{}")
+	}
+	req, err := http.NewRequestWithContext(withProvider(context.Background(), providerName), method, provider.CheckURL, body)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if emptyChat {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := y.httpClient(15 * time.Second).Do(req)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == 401 || resp.StatusCode == 403:
+		check.Status = "invalid"
+		check.Detail = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return check
+	case resp.StatusCode == 402:
+		check.Status = "low_credit"
+		check.Detail = "no credit remaining"
+		return check
+	case emptyChat:
+		check.Detail = fmt.Sprintf("not rejected, but HTTP %d to a probe cannot confirm it", resp.StatusCode)
+		return check
+	case resp.StatusCode != 200:
+		check.Detail = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return check
+	}
+	check.Status = "valid"
+	if providerName == "openrouter" {
+		var keyInfo struct {
+			Data struct {
+				Usage          float64  `json:"usage"`
+				LimitRemaining *float64 `json:"limit_remaining"`
+				IsFreeTier     bool     `json:"is_free_tier"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&keyInfo); err != nil {
+			return check
+		}
+		check.Detail = fmt.Sprintf("$%.2f used", keyInfo.Data.Usage)
+		if keyInfo.Data.LimitRemaining != nil {
+			check.Detail += fmt.Sprintf(", $%.2f remaining", *keyInfo.Data.LimitRemaining)
+			if *keyInfo.Data.LimitRemaining < lowCreditThreshold {
+				check.Status = "low_credit"
+			}
+		} else if keyInfo.Data.IsFreeTier {
+			check.Detail += ", free tier"
+		}
+	}
+	return check
+}
+
+// CheckAPIKeys probes every provider that has a key, in parallel.
+func (y *YuzuChat) CheckAPIKeys() []KeyCheck {
+	var names []string
+	for name, provider := range y.providers {
+		if provider.APIKey != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	checks := make([]KeyCheck, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			checks[i] = y.validateAPIKey(name, y.providers[name].APIKey)
+		}(i, name)
+	}
+	wg.Wait()
+	return checks
+}
+
+// SetKeyCheckOnStartup chooses whether programs should run CheckAPIKeys
+// when they start, and saves it in the profile.
+func (y *YuzuChat) SetKeyCheckOnStartup(enabled bool) error {
+	y.checkKeysOnStartup = enabled
+	return y.saveProfile()
+}
+
+// KeyCheckOnStartup reports whether keys should be checked at startup.
+func (y *YuzuChat) KeyCheckOnStartup() bool {
+	return y.checkKeysOnStartup
+}
+
+// RemoveAPIKey deletes the provider's key file and disables it, switching
+// to another enabled provider if it was the current one.
+func (y *YuzuChat) RemoveAPIKey(providerName string) error {
+	provider, exists := y.providers[providerName]
+	if !exists {
+		return fmt.Errorf("provider '%s' %w", providerName, ErrNotFound)
+	}
+	if err := y.removeKeyFile(provider.KeyFile); err != nil {
+		return fmt.Errorf("removing API key: %w", err)
+	}
+	provider.APIKey = ""
+	provider.IsEnabled = false
+	if y.currentProvider == providerName {
+		for name, p := range y.providers {
+			if p.IsEnabled {
+				y.currentProvider = name
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package yuzu
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestSetAPIKey(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	check, err := chat.SetAPIKey("cerebras", "new-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Status != "valid" {
+		t.Errorf("check = %+v", check)
+	}
+	data, err := os.ReadFile("ce.key")
+	if err != nil || string(data) != "new-key" {
+		t.Fatalf("ce.key = %q, %v", data, err)
+	}
+	if info, _ := os.Stat("ce.key"); info.Mode().Perm() != 0600 {
+		t.Errorf("ce.key mode %v, want 0600", info.Mode().Perm())
+	}
+	if err := chat.ChangeProvider("cerebras"); err != nil {
+		t.Errorf("provider not enabled by its new key: %v", err)
+	}
+}
+
+func TestSetAPIKeyRejected(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	check, err := chat.SetAPIKey("cerebras", fake.InvalidKey)
+	if !errors.Is(err, ErrAuth) || check.Status != "invalid" {
+		t.Fatalf("got %+v, %v; want an invalid check and ErrAuth", check, err)
+	}
+	if _, err := os.Stat("ce.key"); !os.IsNotExist(err) {
+		t.Error("rejected key was saved")
+	}
+	if _, err := chat.SetAPIKey("nope", "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown provider: got %v, want ErrNotFound", err)
+	}
+	if _, err := chat.SetAPIKey("chutes", ""); err == nil {
+		t.Error("empty key accepted")
+	}
+}
+
+func TestSetAPIKeyUnverified(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Close()
+	check, err := chat.SetAPIKey("cerebras", "new-key")
+	if err != nil || check.Status != "unknown" {
+		t.Fatalf("got %+v, %v; want the key saved unverified", check, err)
+	}
+	if _, err := os.Stat("ce.key"); err != nil {
+		t.Errorf("unverified key was not saved: %v", err)
+	}
+}
+
+func TestChutesKeyCheck(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if check := chat.validateAPIKey("chutes", fake.InvalidKey); check.Status != "invalid" {
+		t.Errorf("bad key check = %+v", check)
+	}
+	// A 400 to the empty probe says nothing about the key.
+	if check := chat.validateAPIKey("chutes", "good-key"); check.Status != "unknown" || !strings.Contains(check.Detail, "HTTP 400") {
+		t.Errorf("unrejected key check = %+v", check)
+	}
+	if n := len(fake.Requests()); n != 0 {
+		t.Errorf("key checks made %d chat requests", n)
+	}
+}
+
+func TestOpenRouterCredit(t *testing.T) {
+	tests := []struct {
+		keyInfo string
+		status  string
+		detail  string
+	}{
+		{`{"data":{"usage":7.5,"limit_remaining":12.5}}`, "valid", "$7.50 used, $12.50 remaining"},
+		{`{"data":{"usage":19.9,"limit_remaining":0.1}}`, "low_credit", "$19.90 used, $0.10 remaining"},
+		{`{"data":{"usage":0,"limit_remaining":null,"is_free_tier":true}}`, "valid", "$0.00 used, free tier"},
+	}
+	for _, tt := range tests {
+		fake := fakeprovider.New(t)
+		fake.KeyInfo = tt.keyInfo
+		chat := newTestChat(t, fake)
+		check := chat.validateAPIKey("openrouter", "key")
+		if check.Status != tt.status || check.Detail != tt.detail {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.keyInfo, check.Status, check.Detail, tt.status, tt.detail)
+		}
+	}
+}
+
+func TestCheckAPIKeys(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	writeFile(t, "ce.key", fake.InvalidKey)
+	chat := openChat(t, dir, fake)
+	defer chat.Close()
+
+	checks := chat.CheckAPIKeys()
+	if len(checks) != 2 {
+		t.Fatalf("checks = %+v", checks)
+	}
+	if checks[0].Provider != "cerebras" || checks[0].Status != "invalid" {
+		t.Errorf("cerebras check = %+v", checks[0])
+	}
+	if checks[1].Provider != "chutes" || checks[1].Status != "unknown" {
+		t.Errorf("chutes check = %+v", checks[1])
+	}
+}
+
+func TestRemoveAPIKey(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if _, err := chat.SetAPIKey("openrouter", "test-key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.RemoveAPIKey("chutes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("cu.key"); !os.IsNotExist(err) {
+		t.Error("cu.key still exists")
+	}
+	if chat.CurrentProvider() != "openrouter" {
+		t.Errorf("current provider is %s, want a switch to openrouter", chat.CurrentProvider())
+	}
+	if err := chat.RemoveAPIKey("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown provider: got %v, want ErrNotFound", err)
+	}
+}
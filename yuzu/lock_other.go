@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package yuzu
+
+import "os"
+
+// lockFile does nothing where the platform has no file locks.
+func lockFile(f *os.File) error {
+	return nil
+}
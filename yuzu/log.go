@@ -0,0 +1,138 @@
+package yuzu
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogLevels are the levels SetLogLevel accepts, most verbose first.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// openLog starts the operational log: JSON lines in yuzuchat.log next to the
+// history file, rotated like the debug log. Chat output never goes there,
+// and diagnostics only reach the terminal when the user has to act on them.
+func (y *YuzuChat) openLog() error {
+	y.logLevel = new(slog.LevelVar)
+	y.logPath = filepath.Join(filepath.Dir(y.historyFile), "yuzuchat.log")
+	file, err := OpenRotatingLog(y.logPath)
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+	y.logFile = file
+	y.logger = slog.New(slog.NewJSONHandler(file, &slog.HandlerOptions{Level: y.logLevel}))
+	return nil
+}
+
+func (y *YuzuChat) closeLog() {
+	if y.logFile != nil {
+		y.logFile.Close()
+		y.logFile = nil
+	}
+}
+
+// Logger returns the client's operational logger, for programs that want
+// their own records in the same file.
+func (y *YuzuChat) Logger() *slog.Logger {
+	return y.logger
+}
+
+// LogPath is the file the operational log is written to.
+func (y *YuzuChat) LogPath() string {
+	return y.logPath
+}
+
+// LogLevel is the least severe level currently written to the log.
+func (y *YuzuChat) LogLevel() string {
+	return strings.ToLower(y.logLevel.Level().String())
+}
+
+// SetLogLevel sets the least severe level written to the log to one of
+// LogLevels for this session. The default comes from log_level in the
+// profile.
+func (y *YuzuChat) SetLogLevel(level string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("log level '%s' %w", level, ErrNotFound)
+	}
+	y.logLevel.Set(parsed)
+	return nil
+}
+
+// TailLog returns the last n lines of the log, oldest first.
+func (y *YuzuChat) TailLog(n int) ([]string, error) {
+	data, err := os.ReadFile(y.logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// requestID returns the ID startRequest gave ctx, if any.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// startRequest tags ctx with a new request ID, so every record and debug line
+// for one Send, comparison or proxied call can be picked out of the log, and
+// returns a logger carrying it.
+func (y *YuzuChat) startRequest(ctx context.Context, kind, providerName, model string) (context.Context, *slog.Logger) {
+	id := newRequestID()
+	log := y.logger.With("request_id", id)
+	log.Debug("request started", "kind", kind, "provider", providerName, "model", model)
+	return context.WithValue(ctx, requestIDKey{}, id), log
+}
+
+// log returns the logger for ctx, carrying its request ID if it has one.
+func (y *YuzuChat) log(ctx context.Context) *slog.Logger {
+	if id := requestID(ctx); id != "" {
+		return y.logger.With("request_id", id)
+	}
+	return y.logger
+}
+
+// finishRequest logs the outcome of a request begun with startRequest.
+// Cancellation is what the user asked for, so it is not logged as an error.
+func finishRequest(log *slog.Logger, started time.Time, usage Usage, finishReason string, err error) {
+	duration := slog.Int64("duration_ms", time.Since(started).Milliseconds())
+	switch {
+	case err == nil:
+		log.Info("request finished", duration, "finish_reason", finishReason,
+			"prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+	case errors.Is(err, context.Canceled):
+		log.Info("request cancelled", duration)
+	default:
+		attrs := []interface{}{duration, "error", err.Error()}
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) {
+			attrs = append(attrs, "kind", providerErr.Kind.Error(), "status", providerErr.StatusCode)
+		}
+		log.Error("request failed", attrs...)
+	}
+}
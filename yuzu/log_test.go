@@ -0,0 +1,139 @@
+package yuzu
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+// logRecords returns the records in the client's log file.
+func logRecords(t *testing.T, chat *YuzuChat) []map[string]interface{} {
+	t.Helper()
+	lines, err := chat.TailLog(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func findRecord(records []map[string]interface{}, msg string) map[string]interface{} {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestLogRequests(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if chat.LogPath() != filepath.Join(filepath.Dir(chat.historyFile), "yuzuchat.log") {
+		t.Errorf("log path = %s", chat.LogPath())
+	}
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "fine", Usage: &fakeprovider.Usage{PromptTokens: 3, CompletionTokens: 1}},
+		fakeprovider.Reply{Status: 429, Error: "slow down"},
+	)
+	response, err := chat.Send(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RequestID == "" {
+		t.Error("response has no request ID")
+	}
+	chat.Send(context.Background(), "again")
+
+	records := logRecords(t, chat)
+	if findRecord(records, "client started") == nil {
+		t.Error("startup not logged")
+	}
+	finished := findRecord(records, "request finished")
+	if finished == nil || finished["request_id"] != response.RequestID || finished["prompt_tokens"] != 3.0 {
+		t.Errorf("request finished = %v, want request ID %s", finished, response.RequestID)
+	}
+	failed := findRecord(records, "request failed")
+	if failed == nil || failed["level"] != "ERROR" || failed["kind"] != ErrRateLimited.Error() || failed["status"] != 429.0 {
+		t.Errorf("request failed = %v", failed)
+	}
+	if failed != nil && failed["request_id"] == response.RequestID {
+		t.Error("two requests share an ID")
+	}
+	if findRecord(records, "request started") != nil {
+		t.Error("debug record written at the info level")
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	writeFile(t, "profile.json", `{"log_level": "debug"}`)
+	chat := openChat(t, dir, fake)
+	defer chat.Close()
+	if chat.LogLevel() != "debug" {
+		t.Fatalf("level from profile = %s", chat.LogLevel())
+	}
+	var debugLog syncBuffer
+	chat.SetDebug(&debugLog)
+	response, err := chat.Send(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started := findRecord(logRecords(t, chat), "request started"); started == nil || started["request_id"] != response.RequestID {
+		t.Errorf("request started = %v", started)
+	}
+	if !strings.Contains(debugLog.String(), "(request "+response.RequestID+")") {
+		t.Errorf("debug log lacks the request ID:\n%s", debugLog.String())
+	}
+
+	if err := chat.SetLogLevel("loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+	if err := chat.SetLogLevel("error"); err != nil {
+		t.Fatal(err)
+	}
+	before := len(logRecords(t, chat))
+	if _, err := chat.Send(context.Background(), "quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if after := len(logRecords(t, chat)); after != before {
+		t.Errorf("%d records written at the error level", after-before)
+	}
+	chat.ChangeModel("coder")
+	data, err := os.ReadFile("profile.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"log_level": "debug"`) {
+		t.Errorf("session level leaked into the profile:\n%s", data)
+	}
+}
+
+func TestTailLog(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	for i := 0; i < 5; i++ {
+		chat.Logger().Info("line", "n", i)
+	}
+	lines, err := chat.TailLog(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || !strings.Contains(lines[0], `"n":3`) || !strings.Contains(lines[1], `"n":4`) {
+		t.Errorf("tail = %q", lines)
+	}
+}
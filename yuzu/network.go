@@ -0,0 +1,197 @@
+package yuzu
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Network configures how provider requests leave the machine, for networks
+// that need a proxy or inspect TLS. It is the "network" section of
+// profile.json; file paths are relative to the working directory, like key
+// files.
+type Network struct {
+	// Proxy is used instead of HTTPS_PROXY and NO_PROXY for providers
+	// without a proxy of their own. "direct" ignores the environment.
+	Proxy string `json:"proxy,omitempty"`
+	// CABundle is a PEM file of root certificates trusted on top of the
+	// system ones, such as a corporate TLS inspection CA.
+	CABundle string `json:"ca_bundle,omitempty"`
+	// ClientCert is a PEM certificate presented to servers that ask for
+	// one. ClientKey may be left empty when the same file holds the key.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+}
+
+// SetNetwork rebuilds the connection pool with network for this session. On
+// error the current settings stay in place.
+func (y *YuzuChat) SetNetwork(network Network) error {
+	transport, err := y.newHTTPTransport(network)
+	if err != nil {
+		return err
+	}
+	y.network = network
+	y.pool.replace(transport)
+	return nil
+}
+
+// Network returns the network settings in use.
+func (y *YuzuChat) Network() Network {
+	return y.network
+}
+
+// parseProxy checks a proxy setting, returning nil for "direct". A missing
+// scheme means http, as in HTTPS_PROXY.
+func parseProxy(setting string) (*url.URL, error) {
+	if setting == "direct" {
+		return nil, nil
+	}
+	if !strings.Contains(setting, "://") {
+		setting = "http://" + setting
+	}
+	proxy, err := url.Parse(setting)
+	if err != nil {
+		return nil, fmt.Errorf("proxy '%s' is not a URL", setting)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy '%s' must be http, https or socks5", setting)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("proxy '%s' has no host", setting)
+	}
+	return proxy, nil
+}
+
+type providerKey struct{}
+
+// withProvider tags a request's ctx with the provider it is for, so the
+// transport can pick that provider's proxy.
+func withProvider(ctx context.Context, providerName string) context.Context {
+	return context.WithValue(ctx, providerKey{}, providerName)
+}
+
+// proxyFor chooses the proxy for req: the provider's own, then the one in
+// the network settings, then the environment.
+func (y *YuzuChat) proxyFor(req *http.Request) (*url.URL, error) {
+	setting := y.network.Proxy
+	providerName, _ := req.Context().Value(providerKey{}).(string)
+	if provider, exists := y.providers[providerName]; exists && provider.Proxy != "" {
+		setting = provider.Proxy
+	}
+	if setting == "" {
+		return http.ProxyFromEnvironment(req)
+	}
+	return parseProxy(setting)
+}
+
+// newHTTPTransport builds a transport for network. Dialling and the TLS
+// handshake have no limits of their own here, since connect_timeout covers
+// them per provider.
+func (y *YuzuChat) newHTTPTransport(network Network) (*http.Transport, error) {
+	if network.Proxy != "" {
+		if _, err := parseProxy(network.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig := &tls.Config{}
+	if network.CABundle != "" {
+		data, err := os.ReadFile(network.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in CA bundle %s", network.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	switch {
+	case network.ClientCert != "":
+		keyFile := network.ClientKey
+		if keyFile == "" {
+			keyFile = network.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(network.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case network.ClientKey != "":
+		return nil, fmt.Errorf("client_key is set without client_cert")
+	}
+	return &http.Transport{
+		Proxy:           y.proxyFor,
+		DialContext:     (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig: tlsConfig,
+		// A custom TLS config turns HTTP/2 off unless asked for.
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		// Ping idle HTTP/2 connections so a dead one is noticed before the
+		// next turn is sent down it.
+		HTTP2: &http.HTTP2Config{SendPingTimeout: 30 * time.Second, PingTimeout: 15 * time.Second},
+	}, nil
+}
+
+// sharedTransport is the connection pool every provider request goes
+// through unless SetTransport replaces it, so later turns reuse the
+// connections of earlier ones. SetNetwork swaps the transport underneath,
+// which keeps wrappers such as Record working.
+type sharedTransport struct {
+	mu      sync.Mutex
+	current *http.Transport
+}
+
+func (t *sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	current := t.current
+	t.mu.Unlock()
+	return current.RoundTrip(req)
+}
+
+func (t *sharedTransport) replace(transport *http.Transport) {
+	t.mu.Lock()
+	previous := t.current
+	t.current = transport
+	t.mu.Unlock()
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+func (t *sharedTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current.CloseIdleConnections()
+}
+
+// roundTripper is the transport provider requests start from: the one set
+// with SetTransport, or the shared pool.
+func (y *YuzuChat) roundTripper() http.RoundTripper {
+	if y.transport != nil {
+		return y.transport
+	}
+	return y.pool
+}
+
+// drainBody reads what is left of a small reply body, such as the newline
+// after a JSON object, so the connection can go back to the pool.
+func drainBody(body io.Reader) {
+	io.Copy(io.Discard, io.LimitReader(body, 4<<10))
+}
@@ -0,0 +1,211 @@
+package yuzu
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+// tlsProvider serves fake over HTTPS with HTTP/2, under a certificate of its
+// own, and points chutes at it.
+func tlsProvider(t *testing.T, chat *YuzuChat, fake *fakeprovider.Server, clientAuth tls.ClientAuthType) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(fake.Config.Handler)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: clientAuth}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	chat.SetBaseURL("chutes", server.URL+"/v1")
+	return server
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+	writeFile(t, name, string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})))
+}
+
+func TestConnectionReuse(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	if _, err := chat.Send(context.Background(), "one"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Stream(context.Background(), "two", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "three"); err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.Requests()
+	for _, request := range requests[1:] {
+		if request.RemoteAddr != requests[0].RemoteAddr {
+			t.Errorf("requests came from %s and %s, want one reused connection", requests[0].RemoteAddr, request.RemoteAddr)
+		}
+	}
+}
+
+func TestProxySettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		provider string
+		proxied  bool
+	}{
+		{name: "network proxy", network: "PROXY", proxied: true},
+		{name: "provider proxy", provider: "PROXY", proxied: true},
+		{name: "provider goes direct", network: "PROXY", provider: "direct"},
+		{name: "network goes direct", network: "direct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proxied atomic.Int32
+			forward := &httputil.ReverseProxy{Rewrite: func(r *httputil.ProxyRequest) {}}
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied.Add(1)
+				forward.ServeHTTP(w, r)
+			}))
+			defer proxy.Close()
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			if err := chat.SetNetwork(Network{Proxy: strings.ReplaceAll(tt.network, "PROXY", proxy.URL)}); err != nil {
+				t.Fatal(err)
+			}
+			provider, _ := chat.Provider("chutes")
+			provider.Proxy = strings.ReplaceAll(tt.provider, "PROXY", proxy.URL)
+			resp, err := chat.Stream(context.Background(), "hi", func(string) {})
+			if err != nil || resp.Content != "echo: hi" {
+				t.Fatalf("reply %q, err %v", resp.Content, err)
+			}
+			if got := proxied.Load() > 0; got != tt.proxied {
+				t.Errorf("proxied = %v, want %v", got, tt.proxied)
+			}
+		})
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	server := tlsProvider(t, chat, fake, tls.NoClientCert)
+	if _, err := chat.Send(context.Background(), "untrusted"); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("err = %v, want a certificate error", err)
+	}
+	writePEM(t, "corp-ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	if err := chat.SetNetwork(Network{CABundle: "corp-ca.pem"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "trusted"); err != nil {
+		t.Fatal(err)
+	}
+	if proto := fake.LastRequest().Proto; proto != "HTTP/2.0" {
+		t.Errorf("request went over %s, want HTTP/2", proto)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	server := tlsProvider(t, chat, fake, tls.RequireAnyClientCert)
+	writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, "me.pem", "CERTIFICATE", cert)
+	writePEM(t, "me.key", "PRIVATE KEY", keyDER)
+
+	if err := chat.SetNetwork(Network{CABundle: "ca.pem"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "anonymous"); err == nil {
+		t.Fatal("request without a client certificate succeeded")
+	}
+	if err := chat.SetNetwork(Network{CABundle: "ca.pem", ClientCert: "me.pem", ClientKey: "me.key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "identified"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetNetworkErrors(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	writeFile(t, "empty.pem", "not a certificate")
+	tests := []struct {
+		network Network
+		want    string
+	}{
+		{Network{CABundle: "missing.pem"}, "reading CA bundle"},
+		{Network{CABundle: "empty.pem"}, "no PEM certificates"},
+		{Network{ClientCert: "empty.pem"}, "loading client certificate"},
+		{Network{ClientKey: "me.key"}, "without client_cert"},
+		{Network{Proxy: "ftp://proxy:21"}, "must be http, https or socks5"},
+		{Network{Proxy: "http://"}, "has no host"},
+	}
+	for _, tt := range tests {
+		if err := chat.SetNetwork(tt.network); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("SetNetwork(%+v) = %v, want %q", tt.network, err, tt.want)
+		}
+	}
+	if chat.Network() != (Network{}) {
+		t.Errorf("failed settings were kept: %+v", chat.Network())
+	}
+}
+
+func TestNetworkFromProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "profile.json", `{
+		"network": {"proxy": "direct"},
+		"providers": {
+			"chutes": {"proxy": "proxy.corp:3128"}
+		}
+	}`)
+	chat := openChat(t, dir, fakeprovider.New(t))
+	defer chat.Close()
+	if chat.Network().Proxy != "direct" {
+		t.Errorf("network = %+v", chat.Network())
+	}
+	chutes, _ := chat.Provider("chutes")
+	cerebras, _ := chat.Provider("cerebras")
+	if chutes.Proxy != "proxy.corp:3128" || cerebras.Proxy != "" {
+		t.Errorf("proxies chutes %q, cerebras %q", chutes.Proxy, cerebras.Proxy)
+	}
+	chat.SetAutoContinue(true)
+	data, err := os.ReadFile("profile.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"network": {`, `"proxy": "direct"`, `"proxy": "proxy.corp:3128"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved profile lacks %s:\n%s", want, data)
+		}
+	}
+}
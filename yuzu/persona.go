@@ -0,0 +1,217 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Persona bundles a system prompt with the provider, model and generation
+// parameters it works best with. Personas live as JSON files in personas/.
+type Persona struct {
+	Name         string   `json:"name"`
+	SystemPrompt string   `json:"system_prompt"`
+	Provider     string   `json:"provider,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+}
+
+func (y *YuzuChat) personaFile(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid persona name '%s'", name)
+	}
+	return filepath.Join(y.personasDir, name+".json"), nil
+}
+
+func (y *YuzuChat) loadPersona(name string) (*Persona, error) {
+	filename, err := y.personaFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("persona '%s' %w", name, ErrNotFound)
+		}
+		return nil, err
+	}
+	var persona Persona
+	if err := json.Unmarshal(data, &persona); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	persona.Name = name
+	return &persona, nil
+}
+
+func (y *YuzuChat) savePersona(persona *Persona) error {
+	filename, err := y.personaFile(persona.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(y.personasDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(persona, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data, 0644, true)
+}
+
+func (y *YuzuChat) ListPersonas() []string {
+	entries, err := os.ReadDir(y.personasDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	return names
+}
+
+func (y *YuzuChat) PersonaName() string {
+	if y.persona == nil {
+		return ""
+	}
+	return y.persona.Name
+}
+
+// activeSystemPrompt is the persona's prompt when one is active, otherwise
+// system.txt.
+func (y *YuzuChat) activeSystemPrompt() string {
+	if y.persona != nil && y.persona.SystemPrompt != "" {
+		return y.persona.SystemPrompt
+	}
+	return y.systemPrompt
+}
+
+func (y *YuzuChat) generationParams() (float64, int) {
+	temperature, maxTokens := 0.7, 2048
+	if y.persona != nil {
+		if y.persona.Temperature != nil {
+			temperature = *y.persona.Temperature
+		}
+		if y.persona.MaxTokens > 0 {
+			maxTokens = y.persona.MaxTokens
+		}
+	}
+	return temperature, maxTokens
+}
+
+// UsePersona activates a persona, switching to its provider and model when
+// they are available; "none" goes back to system.txt. Settings that could not
+// be applied are returned as warnings.
+func (y *YuzuChat) UsePersona(name string) ([]string, error) {
+	if name == "none" || name == "off" {
+		y.persona = nil
+		return nil, y.saveProfile()
+	}
+	persona, err := y.loadPersona(name)
+	if err != nil {
+		return nil, err
+	}
+	y.persona = persona
+	var warnings []string
+	if persona.Provider != "" && persona.Provider != y.currentProvider {
+		if provider, exists := y.providers[persona.Provider]; exists && provider.IsEnabled {
+			y.currentProvider = persona.Provider
+			if len(provider.Models) > 0 {
+				y.model = provider.Models[0]
+			}
+		} else {
+			warnings = append(warnings, fmt.Sprintf("provider '%s' is not available, keeping %s", persona.Provider, y.currentProvider))
+		}
+	}
+	if persona.Model != "" {
+		if model, ok := y.findModel(persona.Model); ok {
+			y.model = model
+		} else {
+			warnings = append(warnings, fmt.Sprintf("model '%s' not found for %s, keeping %s", persona.Model, y.currentProvider, y.model))
+		}
+	}
+	return warnings, y.saveProfile()
+}
+
+// NewPersona creates a persona from the current provider and model and
+// returns the file it was saved to. An empty prompt copies the current
+// system prompt.
+func (y *YuzuChat) NewPersona(name, prompt string) (string, error) {
+	filename, err := y.personaFile(name)
+	if err != nil {
+		return "", err
+	}
+	if fileExists(filename) {
+		return "", fmt.Errorf("persona '%s' already exists", name)
+	}
+	if prompt == "" {
+		prompt = y.activeSystemPrompt()
+	}
+	persona := &Persona{Name: name, SystemPrompt: prompt, Provider: y.currentProvider, Model: y.model}
+	if err := y.savePersona(persona); err != nil {
+		return "", fmt.Errorf("saving persona: %w", err)
+	}
+	return filename, nil
+}
+
+// EditPersona sets one field: system, provider, model, temperature or
+// max_tokens.
+func (y *YuzuChat) EditPersona(name, field, value string) error {
+	persona, err := y.loadPersona(name)
+	if err != nil {
+		return err
+	}
+	switch field {
+	case "system":
+		persona.SystemPrompt = value
+	case "provider":
+		if _, exists := y.providers[value]; !exists {
+			return fmt.Errorf("provider '%s' %w", value, ErrNotFound)
+		}
+		persona.Provider = value
+	case "model":
+		persona.Model = value
+	case "temperature":
+		var temperature float64
+		if _, err := fmt.Sscanf(value, "%g", &temperature); err != nil {
+			return fmt.Errorf("invalid temperature '%s'", value)
+		}
+		persona.Temperature = &temperature
+	case "max_tokens":
+		if _, err := fmt.Sscanf(value, "%d", &persona.MaxTokens); err != nil {
+			return fmt.Errorf("invalid max_tokens '%s'", value)
+		}
+	default:
+		return fmt.Errorf("unknown field '%s', use system, provider, model, temperature or max_tokens", field)
+	}
+	if err := y.savePersona(persona); err != nil {
+		return fmt.Errorf("saving persona: %w", err)
+	}
+	if y.PersonaName() == name {
+		y.persona = persona
+	}
+	return nil
+}
+
+func (y *YuzuChat) DeletePersona(name string) error {
+	filename, err := y.personaFile(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("persona '%s' %w", name, ErrNotFound)
+		}
+		return fmt.Errorf("deleting persona: %w", err)
+	}
+	if y.PersonaName() == name {
+		y.persona = nil
+		return y.saveProfile()
+	}
+	return nil
+}
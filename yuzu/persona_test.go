@@ -0,0 +1,138 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestPersonaReplacesSystemPrompt(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	writeFile(t, "system.txt", "base prompt")
+	if _, err := chat.ReloadSystemPrompt(); err != nil {
+		t.Fatal(err)
+	}
+	path, err := chat.NewPersona("pirate", "Talk like a pirate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("persona file: %v", err)
+	}
+	if _, err := chat.NewPersona("pirate", "again"); err == nil {
+		t.Error("existing persona overwritten")
+	}
+	for _, edit := range [][2]string{{"temperature", "0.2"}, {"max_tokens", "100"}, {"model", "chimera"}} {
+		if err := chat.EditPersona("pirate", edit[0], edit[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := chat.EditPersona("pirate", "mood", "grumpy"); err == nil {
+		t.Error("unknown field accepted")
+	}
+
+	if warnings, err := chat.UsePersona("pirate"); err != nil || len(warnings) != 0 {
+		t.Fatalf("UsePersona = %v, %v", warnings, err)
+	}
+	if chat.CurrentModel() != "tngtech/DeepSeek-R1T-Chimera" {
+		t.Errorf("model = %s, want the persona's", chat.CurrentModel())
+	}
+	if _, err := chat.Send(context.Background(), "ahoy"); err != nil {
+		t.Fatal(err)
+	}
+	request := fake.LastRequest()
+	if request.Messages[0].Role != "system" || request.Messages[0].Content != "Talk like a pirate" {
+		t.Errorf("system message = %+v, want the persona prompt", request.Messages[0])
+	}
+	if request.Body["temperature"] != 0.2 || request.Body["max_tokens"] != 100.0 {
+		t.Errorf("temperature %v, max_tokens %v", request.Body["temperature"], request.Body["max_tokens"])
+	}
+	for _, msg := range chat.History() {
+		if msg.Persona != "pirate" {
+			t.Errorf("%s message recorded persona %q", msg.Role, msg.Persona)
+		}
+	}
+	if data, _ := os.ReadFile("system.txt"); string(data) != "base prompt" {
+		t.Errorf("system.txt = %q, the persona must not overwrite it", data)
+	}
+
+	// Switching goes straight from one persona to the other.
+	if _, err := chat.NewPersona("poet", "Answer in verse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.EditPersona("poet", "provider", "cerebras"); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := chat.UsePersona("poet")
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "cerebras") {
+		t.Errorf("switching to a persona with an unavailable provider: %v, %v", warnings, err)
+	}
+	if _, err := chat.Send(context.Background(), "a rose"); err != nil {
+		t.Fatal(err)
+	}
+	if system := fake.LastRequest().Messages[0].Content; system != "Answer in verse" {
+		t.Errorf("system after switching = %q", system)
+	}
+	if _, err := chat.UsePersona("ghost"); !errors.Is(err, ErrNotFound) || chat.PersonaName() != "poet" {
+		t.Errorf("unknown persona: got %v with %q active", err, chat.PersonaName())
+	}
+
+	if _, err := chat.UsePersona("none"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.Send(context.Background(), "plain"); err != nil {
+		t.Fatal(err)
+	}
+	request = fake.LastRequest()
+	if request.Messages[0].Content != "base prompt" || request.Body["temperature"] != 0.7 {
+		t.Errorf("after clearing: system %q, temperature %v", request.Messages[0].Content, request.Body["temperature"])
+	}
+	if history := chat.History(); history[len(history)-1].Persona != "" {
+		t.Errorf("reply without a persona recorded %q", history[len(history)-1].Persona)
+	}
+}
+
+func TestPersonaPersistsInProfile(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+
+	chat := openChat(t, dir, fake)
+	if _, err := chat.NewPersona("pirate", "Talk like a pirate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chat.UsePersona("pirate"); err != nil {
+		t.Fatal(err)
+	}
+	chat.Close()
+	if data, _ := os.ReadFile("profile.json"); !strings.Contains(string(data), `"persona": "pirate"`) {
+		t.Errorf("profile.json = %s", data)
+	}
+
+	chat = openChat(t, dir, fake)
+	if chat.PersonaName() != "pirate" {
+		t.Errorf("persona after reopening = %q", chat.PersonaName())
+	}
+	if err := chat.DeletePersona("pirate"); err != nil {
+		t.Fatal(err)
+	}
+	if chat.PersonaName() != "" {
+		t.Errorf("deleted persona still active")
+	}
+	if err := chat.DeletePersona("pirate"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+	}
+	chat.Close()
+
+	chat = openChat(t, dir, fake)
+	defer chat.Close()
+	if chat.PersonaName() != "" || len(chat.ListPersonas()) != 0 {
+		t.Errorf("after deleting: persona %q, personas %v", chat.PersonaName(), chat.ListPersonas())
+	}
+}
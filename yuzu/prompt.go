@@ -0,0 +1,148 @@
+package yuzu
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ReloadSystemPrompt rereads system.txt and returns the prompt now in use. A
+// missing file clears it; on any other error the old prompt is kept.
+func (y *YuzuChat) ReloadSystemPrompt() (string, error) {
+	data, err := os.ReadFile(y.systemFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			y.systemPrompt = ""
+			return "", nil
+		}
+		return y.systemPrompt, err
+	}
+	y.systemPrompt = string(data)
+	return y.systemPrompt, nil
+}
+
+func (y *YuzuChat) SaveSystemPrompt(prompt string) error {
+	err := writeFileAtomic(y.systemFile, []byte(prompt), 0644, true)
+	if err != nil {
+		return err
+	}
+	y.systemPrompt = prompt
+	return nil
+}
+
+// SystemFile returns the path of system.txt, for editing it directly.
+func (y *YuzuChat) SystemFile() string {
+	return y.systemFile
+}
+
+// SystemPrompt returns the prompt from system.txt, with its {{variables}}
+// filled in as they would be sent when expanded is set.
+func (y *YuzuChat) SystemPrompt(expanded bool) string {
+	if expanded {
+		return y.expandPromptVariables(y.systemPrompt)
+	}
+	return y.systemPrompt
+}
+
+// PersonaPrompt returns the active persona's prompt, which replaces
+// system.txt, or "" when there is none. expanded is as for SystemPrompt.
+func (y *YuzuChat) PersonaPrompt(expanded bool) string {
+	if y.persona == nil {
+		return ""
+	}
+	if expanded {
+		return y.expandPromptVariables(y.persona.SystemPrompt)
+	}
+	return y.persona.SystemPrompt
+}
+
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*(env[.:][A-Za-z_][A-Za-z0-9_]*|[a-z_]+)\s*\}\}`)
+
+// expandPromptVariables fills in {{date}}, {{time}}, {{cwd}}, {{git_branch}},
+// {{os}}, {{user}}, {{model}}, {{provider}} and {{env.NAME}}. Anything else is
+// left untouched.
+func (y *YuzuChat) expandPromptVariables(prompt string) string {
+	if !strings.Contains(prompt, "{{") {
+		return prompt
+	}
+	now := time.Now()
+	return promptVariablePattern.ReplaceAllStringFunc(prompt, func(placeholder string) string {
+		name := promptVariablePattern.FindStringSubmatch(placeholder)[1]
+		if variable, found := strings.CutPrefix(name, "env."); found {
+			return os.Getenv(variable)
+		}
+		if variable, found := strings.CutPrefix(name, "env:"); found {
+			return os.Getenv(variable)
+		}
+		switch name {
+		case "date":
+			return now.Format("2006-01-02")
+		case "time":
+			return now.Format("15:04:05 MST")
+		case "cwd":
+			if cwd, err := os.Getwd(); err == nil {
+				return cwd
+			}
+			return ""
+		case "git_branch":
+			return gitBranch()
+		case "os":
+			return runtime.GOOS + "/" + runtime.GOARCH
+		case "user":
+			if u, err := user.Current(); err == nil {
+				return u.Username
+			}
+			return os.Getenv("USER")
+		case "model":
+			return y.model
+		case "provider":
+			return y.currentProvider
+		}
+		return placeholder
+	})
+}
+
+// gitBranch reads the current branch from the nearest .git directory, or the
+// short commit hash when HEAD is detached.
+func gitBranch() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			if !info.IsDir() {
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return ""
+				}
+				gitPath = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitPath) {
+					gitPath = filepath.Join(dir, gitPath)
+				}
+			}
+			head, err := os.ReadFile(filepath.Join(gitPath, "HEAD"))
+			if err != nil {
+				return ""
+			}
+			ref := strings.TrimSpace(string(head))
+			if strings.HasPrefix(ref, "ref: refs/heads/") {
+				return strings.TrimPrefix(ref, "ref: refs/heads/")
+			}
+			if len(ref) > 7 {
+				return ref[:7]
+			}
+			return ref
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,44 @@
+package yuzu
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestExpandPromptVariables(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	t.Setenv("YUZU_TEAM", "citrus")
+	t.Setenv("ironment", "wrong")
+	if err := os.MkdirAll(".git", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, ".git/HEAD", "ref: refs/heads/feature/zest\n")
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"no placeholders", "no placeholders"},
+		{"Today is {{date}}.", "Today is " + time.Now().Format("2006-01-02") + "."},
+		{"{{ model }} via {{provider}}", "deepseek-ai/DeepSeek-V3-0324 via chutes"},
+		{"on {{os}}", "on " + runtime.GOOS + "/" + runtime.GOARCH},
+		{"in {{cwd}}", "in " + cwd},
+		{"branch {{git_branch}}", "branch feature/zest"},
+		{"team {{env.YUZU_TEAM}} and {{env:YUZU_TEAM}}", "team citrus and citrus"},
+		{"unset {{env.YUZU_NOT_SET}}.", "unset ."},
+		{"{{environment}} and {{envelope}}", "{{environment}} and {{envelope}}"},
+		{"{{unknown}}, {{Date}} and {{ tpl:x }}", "{{unknown}}, {{Date}} and {{ tpl:x }}"},
+	}
+	for _, tt := range tests {
+		if got := chat.expandPromptVariables(tt.prompt); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
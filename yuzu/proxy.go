@@ -0,0 +1,256 @@
+package yuzu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyRoute is one provider/model pair a proxied request can be sent to.
+type proxyRoute struct {
+	Provider string
+	Model    string
+}
+
+// routeModel resolves the model named in a proxied request to candidate
+// routes, in failover order. "provider/model" pins a provider, and the model
+// must then be one of its own. Otherwise an exact model name is tried first,
+// then any model containing it, with the current provider ahead of the
+// others. An empty name means the current provider and model.
+func (y *YuzuChat) routeModel(model string) []proxyRoute {
+	names := y.ListProviders()
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == y.currentProvider) != (names[j] == y.currentProvider) {
+			return names[i] == y.currentProvider
+		}
+		return names[i] < names[j]
+	})
+	if model == "" {
+		if provider, exists := y.providers[y.currentProvider]; exists && provider.IsEnabled {
+			return []proxyRoute{{y.currentProvider, y.model}}
+		}
+		return nil
+	}
+	if name, rest, found := strings.Cut(model, "/"); found {
+		if provider, exists := y.providers[strings.ToLower(name)]; exists && provider.IsEnabled {
+			for _, available := range provider.Models {
+				if strings.EqualFold(available, rest) {
+					return []proxyRoute{{strings.ToLower(name), available}}
+				}
+			}
+			if available, found := findModelIn(provider, rest); found {
+				return []proxyRoute{{strings.ToLower(name), available}}
+			}
+			return nil
+		}
+	}
+	var routes []proxyRoute
+	for _, name := range names {
+		for _, available := range y.providers[name].Models {
+			if strings.EqualFold(available, model) {
+				routes = append(routes, proxyRoute{name, available})
+			}
+		}
+	}
+	if len(routes) > 0 {
+		return routes
+	}
+	for _, name := range names {
+		if available, found := findModelIn(y.providers[name], model); found {
+			routes = append(routes, proxyRoute{name, available})
+		}
+	}
+	return routes
+}
+
+// proxyServer serves /v1/chat/completions and /v1/models for other tools,
+// using the providers and keys configured for the REPL.
+type proxyServer struct {
+	chat *YuzuChat
+	mu   sync.Mutex // serialises metric writes from concurrent requests
+}
+
+// Serve runs the OpenAI-compatible proxy on addr until it fails. Requests
+// are logged to the client's log.
+func (y *YuzuChat) Serve(addr string) error {
+	return http.ListenAndServe(addr, y.proxyHandler())
+}
+
+// proxyHandler routes the proxy's endpoints.
+func (y *YuzuChat) proxyHandler() http.Handler {
+	server := &proxyServer{chat: y}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", server.handleModels)
+	mux.HandleFunc("POST /v1/chat/completions", server.handleChatCompletions)
+	return mux
+}
+
+func writeProxyError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": errType},
+	})
+}
+
+func (p *proxyServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	models := []model{}
+	names := p.chat.ListProviders()
+	sort.Strings(names)
+	for _, name := range names {
+		for _, available := range p.chat.providers[name].Models {
+			models = append(models, model{ID: name + "/" + available, Object: "model", OwnedBy: name})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": models})
+}
+
+// shouldFailover reports whether a provider status is worth retrying on the
+// next route: bad keys, rate limits and server errors are provider specific.
+func shouldFailover(status int) bool {
+	return status == 401 || status == 403 || status == 429 || status >= 500
+}
+
+func (p *proxyServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProxyError(w, 400, "invalid_request_error", fmt.Sprintf("reading body: %v", err))
+		return
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeProxyError(w, 400, "invalid_request_error", fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	var model string
+	var stream bool
+	json.Unmarshal(payload["model"], &model)
+	json.Unmarshal(payload["stream"], &stream)
+	routes := p.chat.routeModel(model)
+	if len(routes) == 0 {
+		writeProxyError(w, 404, "model_not_found", fmt.Sprintf("no enabled provider serves model '%s'", model))
+		return
+	}
+	ctx, log := p.chat.startRequest(r.Context(), "proxy", routes[0].Provider, routes[0].Model)
+	w.Header().Set("X-Yuzu-Request-Id", requestID(ctx))
+	lastErr := ""
+	for i, route := range routes {
+		payload["model"], _ = json.Marshal(route.Model)
+		data, err := json.Marshal(payload)
+		if err != nil {
+			writeProxyError(w, 400, "invalid_request_error", fmt.Sprintf("encoding request: %v", err))
+			return
+		}
+		req, err := p.chat.newProviderRequest(route.Provider, data)
+		if err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		startTime := time.Now()
+		resp, err := p.chat.send(route.Provider, req.WithContext(ctx))
+		if err != nil {
+			lastErr = err.Error()
+			log.Warn("provider failed", "provider", route.Provider, "model", route.Model, "error", err.Error())
+			continue
+		}
+		if shouldFailover(resp.StatusCode) && i < len(routes)-1 {
+			resp.Body.Close()
+			log.Warn("provider failed over", "provider", route.Provider, "model", route.Model, "status", resp.StatusCode,
+				"next_provider", routes[i+1].Provider, "next_model", routes[i+1].Model)
+			continue
+		}
+		p.relay(w, resp, route, stream, startTime, log)
+		return
+	}
+	log.Error("all providers failed", "error", lastErr)
+	writeProxyError(w, 502, "provider_unavailable", fmt.Sprintf("all providers failed, last error: %s", lastErr))
+}
+
+// relay copies the provider response to the client, flushing streamed events
+// as they arrive, and logs and records the usage it reports.
+func (p *proxyServer) relay(w http.ResponseWriter, resp *http.Response, route proxyRoute, stream bool, startTime time.Time, log *slog.Logger) {
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("X-Yuzu-Provider", route.Provider)
+	w.WriteHeader(resp.StatusCode)
+	var usage Usage
+	estimated := false
+	if stream && resp.StatusCode == 200 {
+		flusher, _ := w.(http.Flusher)
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				w.Write(line)
+				if flusher != nil {
+					flusher.Flush()
+				}
+				if data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data: ")); found {
+					var chunk struct {
+						Choices []struct {
+							Delta struct {
+								Content string `json:"content"`
+							} `json:"delta"`
+						} `json:"choices"`
+						Usage *Usage `json:"usage"`
+					}
+					if json.Unmarshal(data, &chunk) == nil {
+						if chunk.Usage != nil {
+							usage = *chunk.Usage
+						} else if len(chunk.Choices) > 0 {
+							usage.CompletionTokens += len(chunk.Choices[0].Delta.Content) / 4
+							estimated = true
+						}
+					}
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					log.Warn("relayed stream broke off", "provider", route.Provider, "error", err.Error())
+				}
+				break
+			}
+		}
+	} else {
+		data, _ := io.ReadAll(resp.Body)
+		w.Write(data)
+		var apiResp struct {
+			Usage Usage `json:"usage"`
+		}
+		json.Unmarshal(data, &apiResp)
+		usage = apiResp.Usage
+	}
+	duration := time.Since(startTime)
+	log.Info("request relayed", "provider", route.Provider, "model", route.Model, "status", resp.StatusCode,
+		"duration_ms", duration.Milliseconds(), "prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens,
+		"estimated", estimated && usage.PromptTokens == 0)
+	if resp.StatusCode != 200 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chat.recordMetric(Metric{
+		Provider:         route.Provider,
+		Model:            route.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		DurationMs:       duration.Milliseconds(),
+		Streamed:         stream,
+	})
+}
@@ -0,0 +1,199 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+// newProxy serves the proxy for a chat with chutes on first and cerebras on
+// second, both offering "shared".
+func newProxy(t *testing.T, first, second *fakeprovider.Server) (*YuzuChat, string) {
+	t.Helper()
+	chat := newTestChat(t, first)
+	chat.SetBaseURL("cerebras", second.BaseURL())
+	chat.providers["cerebras"].APIKey = "test-key"
+	chat.providers["cerebras"].IsEnabled = true
+	chat.providers["chutes"].Models = []string{"shared", "chutes-only"}
+	chat.providers["cerebras"].Models = []string{"shared", "cerebras-only"}
+	server := httptest.NewServer(chat.proxyHandler())
+	t.Cleanup(server.Close)
+	return chat, server.URL
+}
+
+// postChat sends a chat completion for model through the proxy at url.
+func postChat(t *testing.T, url, model string, stream bool) (*http.Response, string) {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"model":    model,
+		"stream":   stream,
+		"messages": []map[string]string{{"role": "user", "content": "hi"}},
+	})
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", strings.NewReader(string(payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestProxyRoutesModels(t *testing.T) {
+	first, second := fakeprovider.New(t), fakeprovider.New(t)
+	_, url := newProxy(t, first, second)
+	tests := []struct {
+		model    string
+		provider string
+		sent     string
+	}{
+		{"shared", "chutes", "shared"},
+		{"cerebras-only", "cerebras", "cerebras-only"},
+		{"cerebras/shared", "cerebras", "shared"},
+		{"cerebras/CEREBRAS-ONLY", "cerebras", "cerebras-only"},
+		{"chutes/only", "chutes", "chutes-only"},
+		{"CHUTES-ONLY", "chutes", "chutes-only"},
+	}
+	for _, tt := range tests {
+		resp, body := postChat(t, url, tt.model, false)
+		if resp.StatusCode != 200 || !strings.Contains(body, "echo: hi") {
+			t.Fatalf("%s: status %d, body %s", tt.model, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("X-Yuzu-Provider"); got != tt.provider {
+			t.Errorf("%s went to %s, want %s", tt.model, got, tt.provider)
+		}
+		fake := first
+		if tt.provider == "cerebras" {
+			fake = second
+		}
+		if got := fake.LastRequest().Model; got != tt.sent {
+			t.Errorf("%s was sent as %q, want %q", tt.model, got, tt.sent)
+		}
+	}
+	requests := len(first.Requests()) + len(second.Requests())
+	for _, model := range []string{"nobody-has-this", "chutes/cerebras-only", "cerebras/nobody-has-this"} {
+		resp, body := postChat(t, url, model, false)
+		if resp.StatusCode != 404 || !strings.Contains(body, "model_not_found") {
+			t.Errorf("%s: status %d, body %s", model, resp.StatusCode, body)
+		}
+	}
+	if n := len(first.Requests()) + len(second.Requests()) - requests; n != 0 {
+		t.Errorf("unknown models sent %d requests upstream", n)
+	}
+}
+
+func TestProxyWithoutUpstreamContentType(t *testing.T) {
+	first, second := fakeprovider.New(t), fakeprovider.New(t)
+	chat, url := newProxy(t, first, second)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"bare"}}]}`)
+	}))
+	t.Cleanup(upstream.Close)
+	chat.SetBaseURL("chutes", upstream.URL)
+	resp, body := postChat(t, url, "chutes/shared", false)
+	if resp.StatusCode != 200 || !strings.Contains(body, "bare") {
+		t.Fatalf("status %d, body %s", resp.StatusCode, body)
+	}
+	if values := resp.Header.Values("Content-Type"); len(values) != 1 || values[0] == "" {
+		t.Errorf("Content-Type = %q, want one set by the proxy's own server", values)
+	}
+}
+
+func TestProxyFailover(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    *fakeprovider.Reply
+		provider string
+		status   int
+	}{
+		{name: "rate limited", reply: &fakeprovider.Reply{Status: 429, Error: "slow down"}, provider: "cerebras", status: 200},
+		{name: "server error", reply: &fakeprovider.Reply{Status: 503, Error: "overloaded"}, provider: "cerebras", status: 200},
+		{name: "network error", provider: "cerebras", status: 200},
+		{name: "bad request is not retried", reply: &fakeprovider.Reply{Status: 400, Error: "bad"}, provider: "chutes", status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := fakeprovider.New(t), fakeprovider.New(t)
+			chat, url := newProxy(t, first, second)
+			if tt.reply != nil {
+				first.Enqueue(*tt.reply)
+			} else {
+				down := httptest.NewServer(http.NotFoundHandler())
+				down.Close()
+				chat.SetBaseURL("chutes", down.URL+"/v1")
+			}
+			resp, body := postChat(t, url, "shared", false)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			if got := resp.Header.Get("X-Yuzu-Provider"); got != tt.provider {
+				t.Errorf("answered by %s, want %s", got, tt.provider)
+			}
+			if tt.provider == "cerebras" && second.LastRequest().Model != "shared" {
+				t.Errorf("cerebras got model %q", second.LastRequest().Model)
+			}
+		})
+	}
+}
+
+func TestProxyAllRoutesFailed(t *testing.T) {
+	first, second := fakeprovider.New(t), fakeprovider.New(t)
+	chat, url := newProxy(t, first, second)
+	first.Enqueue(fakeprovider.Reply{Status: 500, Error: "boom"})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	chat.SetBaseURL("cerebras", down.URL+"/v1")
+
+	resp, body := postChat(t, url, "shared", false)
+	if resp.StatusCode != 502 {
+		t.Fatalf("status %d, want 502: %s", resp.StatusCode, body)
+	}
+	var reply struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatalf("error body %s: %v", body, err)
+	}
+	if reply.Error.Type != "provider_unavailable" || !strings.Contains(reply.Error.Message, "all providers failed") ||
+		!strings.Contains(reply.Error.Message, "connection refused") {
+		t.Errorf("error = %+v", reply.Error)
+	}
+	if resp.Header.Get("X-Yuzu-Request-Id") == "" {
+		t.Error("no request ID on the error")
+	}
+
+	// When the last route answers, its error goes back as it is.
+	chat.SetBaseURL("cerebras", second.BaseURL())
+	first.Enqueue(fakeprovider.Reply{Status: 500, Error: "boom"})
+	second.Enqueue(fakeprovider.Reply{Status: 503, Error: "also down"})
+	resp, body = postChat(t, url, "shared", false)
+	if resp.StatusCode != 503 || !strings.Contains(body, "also down") {
+		t.Errorf("status %d, body %s, want the last provider's 503", resp.StatusCode, body)
+	}
+}
+
+func TestProxyRelaysStream(t *testing.T) {
+	first, second := fakeprovider.New(t), fakeprovider.New(t)
+	_, url := newProxy(t, first, second)
+	first.Enqueue(fakeprovider.Reply{Chunks: []string{"Hello", ", ", "world"}})
+	resp, body := postChat(t, url, "shared", true)
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, chunk := range []string{`"Hello"`, `", "`, `"world"`, "data: [DONE]"} {
+		if !strings.Contains(body, chunk) {
+			t.Errorf("stream lacks %s:\n%s", chunk, body)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package yuzu
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchQuery selects archived messages. Every pattern must match the content.
+type SearchQuery struct {
+	Patterns []*regexp.Regexp
+	Role     string
+	Model    string
+	Provider string
+	// Session limits the search to one session; "current" stands for the
+	// session in use.
+	Session string
+	From    time.Time
+	To      time.Time
+
+	// terms are the plain words behind Patterns, which the SQLite store
+	// narrows the search with before the patterns are applied.
+	terms []string
+}
+
+type SearchHit struct {
+	Index   int
+	Message Message
+}
+
+const maxSearchResults = 30
+
+// ParseSearchArgs builds a SearchQuery from /search arguments. Quoted words
+// form a phrase, --regex treats the terms as one regular expression, and
+// --role, --model, --provider, --session, --from and --to filter the results.
+func ParseSearchArgs(args []string) (SearchQuery, error) {
+	var query SearchQuery
+	var terms []string
+	useRegex := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--regex":
+			useRegex = true
+			continue
+		case "--role", "--model", "--provider", "--session", "--from", "--to":
+			if i+1 >= len(args) {
+				return query, fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			value := args[i]
+			switch arg {
+			case "--role":
+				query.Role = strings.ToLower(value)
+			case "--model":
+				query.Model = strings.ToLower(value)
+			case "--provider":
+				query.Provider = strings.ToLower(value)
+			case "--session":
+				query.Session = value
+			case "--from":
+				t, err := ParseDateArg(value)
+				if err != nil {
+					return query, fmt.Errorf("invalid from date '%s'", value)
+				}
+				query.From = t
+			case "--to":
+				t, err := ParseDateArg(value)
+				if err != nil {
+					return query, fmt.Errorf("invalid to date '%s'", value)
+				}
+				if len(value) == len("2006-01-02") {
+					t = t.AddDate(0, 0, 1)
+				}
+				query.To = t
+			}
+			continue
+		}
+		terms = append(terms, arg)
+	}
+	if len(terms) == 0 {
+		return query, fmt.Errorf("empty search query")
+	}
+	if useRegex {
+		re, err := regexp.Compile(strings.Join(terms, " "))
+		if err != nil {
+			return query, err
+		}
+		query.Patterns = []*regexp.Regexp{re}
+		return query, nil
+	}
+	for _, term := range terms {
+		query.Patterns = append(query.Patterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(term)))
+	}
+	query.terms = terms
+	return query, nil
+}
+
+func (q SearchQuery) Matches(msg Message) bool {
+	if q.Role != "" && msg.Role != q.Role {
+		return false
+	}
+	if q.Session != "" && msg.Session != q.Session {
+		return false
+	}
+	if q.Model != "" && !strings.Contains(strings.ToLower(msg.Model), q.Model) {
+		return false
+	}
+	if q.Provider != "" && !strings.Contains(strings.ToLower(msg.Provider), q.Provider) {
+		return false
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		if len(filterMessagesByDate([]Message{msg}, q.From, q.To)) == 0 {
+			return false
+		}
+	}
+	for _, pattern := range q.Patterns {
+		if !pattern.MatchString(msg.Content) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns matching archived messages, newest first.
+func (y *YuzuChat) Search(query SearchQuery) ([]SearchHit, error) {
+	if query.Session == "current" {
+		query.Session = y.sessionID
+	}
+	hits, err := y.store.SearchArchive(query, maxSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	y.lastSearch = hits
+	return hits, nil
+}
+
+// searchMessages returns up to limit messages of archive that match query,
+// newest first.
+func searchMessages(archive []Message, query SearchQuery, limit int) []SearchHit {
+	var hits []SearchHit
+	for i := len(archive) - 1; i >= 0 && len(hits) < limit; i-- {
+		if query.Matches(archive[i]) {
+			hits = append(hits, SearchHit{Index: i, Message: archive[i]})
+		}
+	}
+	return hits
+}
+
+// Snippet returns the text around the first match of pattern in content,
+// on one line, and where the match lies within it; start and end are -1 when
+// nothing matches.
+func Snippet(content string, pattern *regexp.Regexp) (snippet string, start, end int) {
+	content = strings.Join(strings.Fields(content), " ")
+	loc := pattern.FindStringIndex(content)
+	if loc == nil {
+		if len(content) > 80 {
+			cut := 80
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			return content[:cut] + "…", -1, -1
+		}
+		return content, -1, -1
+	}
+	from := loc[0] - 40
+	prefix := "…"
+	if from <= 0 {
+		from = 0
+		prefix = ""
+	}
+	to := loc[1] + 40
+	suffix := "…"
+	if to >= len(content) {
+		to = len(content)
+		suffix = ""
+	}
+	for from > 0 && !utf8.RuneStart(content[from]) {
+		from--
+	}
+	for to < len(content) && !utf8.RuneStart(content[to]) {
+		to++
+	}
+	start = len(prefix) + loc[0] - from
+	end = start + loc[1] - loc[0]
+	return prefix + content[from:to] + suffix, start, end
+}
+
+// OpenSearchResult loads the branch containing result n as the current
+// conversation. With fork, only the messages up to and including the match are
+// copied into a new session. It returns the number of messages loaded.
+func (y *YuzuChat) OpenSearchResult(n int, fork bool) (int, error) {
+	if n < 1 || n > len(y.lastSearch) {
+		return 0, fmt.Errorf("search result #%d %w", n, ErrNotFound)
+	}
+	hit := y.lastSearch[n-1]
+	archive, err := y.loadArchive()
+	if err != nil {
+		return 0, fmt.Errorf("loading archive: %w", err)
+	}
+	if hit.Index >= len(archive) {
+		return 0, errors.New("archive changed since the search, search again")
+	}
+	session := hit.Message.Session
+	var messages []Message
+	if hit.Message.ID != "" {
+		tree := buildMessageTree(archive, session)
+		if fork {
+			messages = tree.pathTo(hit.Message.ID)
+		} else {
+			messages = tree.pathTo(tree.latestLeaf(hit.Message.ID))
+		}
+	} else {
+		for i, msg := range archive {
+			if fork && i > hit.Index {
+				break
+			}
+			if msg.Session == session {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	if fork {
+		y.sessionID = newSessionID()
+		for i := range messages {
+			messages[i].Session = y.sessionID
+		}
+		if err := y.appendToArchive(messages...); err != nil {
+			return 0, err
+		}
+	} else {
+		y.sessionID = session
+	}
+	y.conversationHistory = messages
+	y.trimHistory()
+	return len(messages), y.saveHistory()
+}
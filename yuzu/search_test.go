@@ -0,0 +1,158 @@
+package yuzu
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestParseSearchArgs(t *testing.T) {
+	query, err := ParseSearchArgs([]string{"goroutine leak", "--role", "Assistant", "--model", "GPT", "--session", "current", "--to", "2024-05-01", "context"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Patterns) != 2 || !query.Patterns[0].MatchString("a Goroutine Leak here") || query.Patterns[0].MatchString("goroutine that leaks") {
+		t.Errorf("patterns = %v", query.Patterns)
+	}
+	if query.Role != "assistant" || query.Model != "gpt" || query.Session != "current" || query.To.Day() != 2 {
+		t.Errorf("query = %+v", query)
+	}
+	if query, err := ParseSearchArgs([]string{"--regex", "leak(s|ed)?", "fix"}); err != nil || len(query.Patterns) != 1 || !query.Patterns[0].MatchString("leaked fix") {
+		t.Errorf("regex query = %+v, %v", query, err)
+	}
+	for _, args := range [][]string{{}, {"--role"}, {"--role", "user"}, {"--regex", "("}, {"x", "--from", "last week"}} {
+		if _, err := ParseSearchArgs(args); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	for _, backend := range []string{"sqlite", "json"} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeFile(t, "cu.key", "test-key")
+			writeFile(t, "profile.json", `{"storage": "`+backend+`"}`)
+			chat := openChat(t, dir, fakeprovider.New(t))
+			defer chat.Close()
+
+			archive := []Message{
+				{Session: "old", Role: "user", Content: "How do I find a goroutine leak?", Model: "llama-3.3-70b", Provider: "cerebras", Timestamp: "2024-05-01T10:00:00Z"},
+				{Session: "old", Role: "assistant", Content: "Use pprof to find the goroutine LEAK.", Model: "llama-3.3-70b", Provider: "cerebras", Timestamp: "2024-05-01T10:00:05Z"},
+				{Session: "old", Role: "user", Content: "Is 50%_off a discount?", Model: "llama-3.3-70b", Provider: "cerebras", Timestamp: "2024-05-01T10:01:00Z"},
+				{Session: chat.SessionID(), Role: "user", Content: "ÉCLAIR recipes and goroutines", Model: "deepseek-v3", Provider: "chutes", Timestamp: "2024-06-01T09:00:00Z"},
+				{Session: chat.SessionID(), Role: "assistant", Content: "An éclair needs choux pastry.", Model: "deepseek-v3", Provider: "chutes", Timestamp: "2024-06-01T09:00:05Z"},
+			}
+			if err := chat.appendToArchive(archive...); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				args []string
+				want []int // archive indexes, newest first
+			}{
+				{[]string{"goroutine", "leak"}, []int{1, 0}},
+				{[]string{"goroutine"}, []int{3, 1, 0}},
+				{[]string{"goroutine", "--role", "assistant"}, []int{1}},
+				{[]string{"goroutine", "--session", "old"}, []int{1, 0}},
+				{[]string{"goroutine", "--session", "current"}, []int{3}},
+				{[]string{"goroutine", "--session", "missing"}, nil},
+				{[]string{"goroutine", "--provider", "CHUTES"}, []int{3}},
+				{[]string{"pprof", "--model", "llama"}, []int{1}},
+				{[]string{"50%_off"}, []int{2}},
+				{[]string{"0%"}, []int{2}},
+				{[]string{"_"}, []int{2}},
+				{[]string{"éclair"}, []int{4, 3}},
+				{[]string{"--regex", `goroutine (leak|LEAK)\?`}, []int{0}},
+				{[]string{"goroutine", "--from", "2024-06-01"}, []int{3}},
+				{[]string{"goroutine", "--to", "2024-05-01"}, []int{1, 0}},
+			}
+			for _, tt := range tests {
+				query, err := ParseSearchArgs(tt.args)
+				if err != nil {
+					t.Fatal(err)
+				}
+				hits, err := chat.Search(query)
+				if err != nil {
+					t.Fatalf("%q: %v", tt.args, err)
+				}
+				var got []int
+				for _, hit := range hits {
+					if hit.Message.Content != archive[hit.Index].Content {
+						t.Errorf("%q: hit at %d is %q", tt.args, hit.Index, hit.Message.Content)
+					}
+					got = append(got, hit.Index)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("%q: hits %v, want %v", tt.args, got, tt.want)
+				}
+			}
+
+			if _, err := chat.OpenSearchResult(1, false); err != nil {
+				t.Fatal(err)
+			}
+			if chat.SessionID() != "old" {
+				t.Errorf("opened session %s, want the last hit's", chat.SessionID())
+			}
+		})
+	}
+}
+
+func TestSearchResultLimit(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	var archive []Message
+	for i := 0; i < maxSearchResults+5; i++ {
+		archive = append(archive, Message{Session: "s", Role: "user", Content: "needle"})
+	}
+	if err := chat.appendToArchive(archive...); err != nil {
+		t.Fatal(err)
+	}
+	query, _ := ParseSearchArgs([]string{"needle"})
+	hits, err := chat.Search(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != maxSearchResults || hits[0].Index != len(archive)-1 {
+		t.Errorf("%d hits, first at %d", len(hits), hits[0].Index)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	tests := []struct {
+		content string
+		pattern string
+		want    string
+		match   string
+	}{
+		{"short  text\nhere", "nothing", "short text here", ""},
+		{long, "nothing", strings.Repeat("a", 80) + "…", ""},
+		{strings.Repeat("é", 50), "nothing", strings.Repeat("é", 40) + "…", ""},
+		{"needle " + long, "needle", "needle " + strings.Repeat("a", 39) + "…", "needle"},
+		{long + " needle", "needle", "…" + strings.Repeat("a", 39) + " needle", "needle"},
+		{long + " needle " + long, "needle", "…" + strings.Repeat("a", 39) + " needle " + strings.Repeat("a", 39) + "…", "needle"},
+		{strings.Repeat("é", 30) + "x needle", "needle", "…" + strings.Repeat("é", 19) + "x needle", "needle"},
+		{"a NEEDLE", "(?i)needle", "a NEEDLE", "NEEDLE"},
+	}
+	for _, tt := range tests {
+		snippet, start, end := Snippet(tt.content, regexp.MustCompile(tt.pattern))
+		if snippet != tt.want {
+			t.Errorf("Snippet(%.20q, %s) = %q, want %q", tt.content, tt.pattern, snippet, tt.want)
+		}
+		if !utf8.ValidString(snippet) {
+			t.Errorf("Snippet(%.20q) split a rune", tt.content)
+		}
+		if tt.match == "" {
+			if start != -1 || end != -1 {
+				t.Errorf("Snippet(%.20q, %s) match at %d-%d, want none", tt.content, tt.pattern, start, end)
+			}
+		} else if start < 0 || snippet[start:end] != tt.match {
+			t.Errorf("Snippet(%.20q, %s) match at %d-%d, want %q", tt.content, tt.pattern, start, end, tt.match)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package yuzu
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sseEvent is one server-sent event. Event is empty for the default
+// "message" type.
+type sseEvent struct {
+	Event string
+	Data  string
+	ID    string
+}
+
+// sseReader splits a text/event-stream body into events following the
+// WHATWG rules: lines may end in LF, CRLF or CR and be any length, data lines
+// of one event are joined with newlines, lines starting with a colon are
+// comments (OpenRouter's ": OPENROUTER PROCESSING" keep-alives), and a blank
+// line ends the event.
+type sseReader struct {
+	r      *bufio.Reader
+	skipLF bool // the last line ended in CR, so a following LF belongs to it
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+func (s *sseReader) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+		if s.skipLF {
+			s.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\n':
+			return string(line), nil
+		case '\r':
+			s.skipLF = true
+			return string(line), nil
+		}
+		line = append(line, b)
+	}
+}
+
+// Next returns the next event with data. Unlike the spec, an event cut off
+// by the end of the body is still returned, since some providers leave out
+// the final blank line.
+func (s *sseReader) Next() (sseEvent, error) {
+	var event sseEvent
+	var data strings.Builder
+	hasData := false
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			if err == io.EOF && hasData {
+				event.Data = strings.TrimSuffix(data.String(), "\n")
+				return event, nil
+			}
+			return sseEvent{}, err
+		}
+		if line == "" {
+			if hasData {
+				event.Data = strings.TrimSuffix(data.String(), "\n")
+				return event, nil
+			}
+			event = sseEvent{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "event":
+			event.Event = value
+		case "id":
+			event.ID = value
+		}
+	}
+}
+
+// streamedReply is what a streamed chat completion delivered.
+type streamedReply struct {
+	Content string
+	// Usage is set when the provider reported it, usually in the last chunk.
+	Usage        *Usage
+	FinishReason string
+}
+
+// readChatStream reads a streamed chat completion, passing each piece of the
+// reply to onDelta. An error event or an {"error": ...} chunk becomes a
+// ProviderError, as does a stream that ends without [DONE] or a finish
+// reason, since the reply was then cut off. Events that are not JSON are
+// logged and skipped rather than losing the rest of the reply.
+func readChatStream(log *slog.Logger, providerName string, body io.Reader, onDelta func(string)) (streamedReply, error) {
+	var reply streamedReply
+	var content strings.Builder
+	events := newSSEReader(body)
+	for {
+		event, err := events.Next()
+		if err == io.EOF {
+			reply.Content = content.String()
+			if reply.FinishReason == "" {
+				return reply, &ProviderError{Kind: ErrNetwork, Provider: providerName, Message: "stream ended before the reply was complete"}
+			}
+			return reply, nil
+		}
+		if err != nil {
+			reply.Content = content.String()
+			return reply, networkError(providerName, err)
+		}
+		if event.Data == "" {
+			continue
+		}
+		if event.Data == "[DONE]" {
+			reply.Content = content.String()
+			return reply, nil
+		}
+		if event.Event == "error" {
+			reply.Content = content.String()
+			return reply, streamError(providerName, []byte(event.Data))
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *Usage          `json:"usage"`
+			Error json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			data := event.Data
+			if len(data) > 200 {
+				data = data[:200] + "..."
+			}
+			log.Warn("skipping malformed stream event", "provider", providerName, "data", data, "error", err.Error())
+			continue
+		}
+		if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+			reply.Content = content.String()
+			return reply, streamError(providerName, []byte(event.Data))
+		}
+		if chunk.Usage != nil {
+			reply.Usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if text := chunk.Choices[0].Delta.Content; text != "" {
+			onDelta(text)
+			content.WriteString(text)
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			reply.FinishReason = reason
+		}
+	}
+}
+
+// streamError classifies an error a provider sent after the stream had
+// started, when the HTTP status was already 200. A numeric error code is
+// taken as the status the request would otherwise have failed with; without
+// one the upstream model is assumed to have failed.
+func streamError(providerName string, data []byte) *ProviderError {
+	code, message := providerErrorMessage(data)
+	if message == "" {
+		message = "error event without a message"
+	}
+	status, _ := strconv.Atoi(code)
+	kindStatus := status
+	if kindStatus == 0 {
+		kindStatus = http.StatusBadGateway
+	}
+	return &ProviderError{
+		Kind:       classifyProviderError(kindStatus, code, message),
+		Provider:   providerName,
+		StatusCode: status,
+		Code:       code,
+		Message:    "mid-stream: " + message,
+	}
+}
@@ -0,0 +1,168 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func readEvents(t *testing.T, stream string) []sseEvent {
+	t.Helper()
+	reader := newSSEReader(strings.NewReader(stream))
+	var events []sseEvent
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestSSEReader(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	tests := []struct {
+		name   string
+		stream string
+		want   []sseEvent
+	}{
+		{"lf", "data: a\n\ndata: b\n\n", []sseEvent{{Data: "a"}, {Data: "b"}}},
+		{"crlf", "data: a\r\n\r\ndata: b\r\n\r\n", []sseEvent{{Data: "a"}, {Data: "b"}}},
+		{"cr", "data: a\r\rdata: b\r\r", []sseEvent{{Data: "a"}, {Data: "b"}}},
+		{"multi-line data", "data: one\ndata: two\ndata\n\n", []sseEvent{{Data: "one\ntwo\n"}}},
+		{"comments", ": OPENROUTER PROCESSING\n\n:ping\ndata: a\n\n", []sseEvent{{Data: "a"}}},
+		{"event and id", "event: error\nid: 7\ndata: {}\n\n", []sseEvent{{Event: "error", ID: "7", Data: "{}"}}},
+		{"no space after colon", "data:a\n\n", []sseEvent{{Data: "a"}}},
+		{"event without data", "event: ping\n\ndata: a\n\n", []sseEvent{{Data: "a"}}},
+		{"unterminated", "data: a\n\ndata: b", []sseEvent{{Data: "a"}, {Data: "b"}}},
+		{"long line", "data: " + long + "\n\n", []sseEvent{{Data: long}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readEvents(t, tt.stream); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadChatStream(t *testing.T) {
+	chunk := func(content string) string {
+		return `data: {"choices":[{"delta":{"content":"` + content + `"}}]}` + "\n\n"
+	}
+	tests := []struct {
+		name    string
+		stream  string
+		content string
+		finish  string
+		usage   *Usage
+		kind    error
+	}{
+		{
+			name:    "finish reason and usage",
+			stream:  chunk("a") + chunk("b") + `data: {"choices":[{"delta":{},"finish_reason":"length"}],"usage":{"prompt_tokens":4,"completion_tokens":2}}` + "\n\ndata: [DONE]\n\n",
+			content: "ab",
+			finish:  "length",
+			usage:   &Usage{PromptTokens: 4, CompletionTokens: 2},
+		},
+		{
+			name:    "finish reason without done",
+			stream:  chunk("a") + `data: {"choices":[{"delta":{},"finish_reason":"content_filter"}]}` + "\n\n",
+			content: "a",
+			finish:  "content_filter",
+		},
+		{
+			name:    "malformed event skipped",
+			stream:  chunk("a") + "data: {oops\n\n" + chunk("b") + "data: [DONE]\n\n",
+			content: "ab",
+		},
+		{
+			name:    "error chunk",
+			stream:  chunk("a") + `data: {"error":{"code":429,"message":"Rate limit exceeded upstream"},"choices":[{"delta":{},"finish_reason":"error"}]}` + "\n\n",
+			content: "a",
+			kind:    ErrRateLimited,
+		},
+		{
+			name:   "error event",
+			stream: "event: error\ndata: {\"error\":{\"message\":\"model overloaded\"}}\n\n",
+			kind:   ErrProviderUnavailable,
+		},
+		{
+			name:    "cut off",
+			stream:  chunk("a") + chunk("b"),
+			content: "ab",
+			kind:    ErrNetwork,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed strings.Builder
+			reply, err := readChatStream(slog.New(slog.DiscardHandler), "chutes", strings.NewReader(tt.stream), func(delta string) {
+				streamed.WriteString(delta)
+			})
+			if tt.kind != nil {
+				if !errors.Is(err, tt.kind) {
+					t.Errorf("err = %v, want %v", err, tt.kind)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Content != tt.content || streamed.String() != tt.content {
+				t.Errorf("content %q, streamed %q, want %q", reply.Content, streamed.String(), tt.content)
+			}
+			if reply.FinishReason != tt.finish {
+				t.Errorf("finish reason = %q, want %q", reply.FinishReason, tt.finish)
+			}
+			if !reflect.DeepEqual(reply.Usage, tt.usage) {
+				t.Errorf("usage = %+v, want %+v", reply.Usage, tt.usage)
+			}
+		})
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(
+		fakeprovider.Reply{Content: "half an ans", FinishReason: "length"},
+		fakeprovider.Reply{Content: "half an ans", FinishReason: "length"},
+		fakeprovider.Reply{Content: "done"},
+	)
+	resp, err := chat.Send(context.Background(), "one")
+	if err != nil || resp.FinishReason != "length" {
+		t.Errorf("send: finish reason %q, err %v", resp.FinishReason, err)
+	}
+	resp, err = chat.Stream(context.Background(), "two", func(string) {})
+	if err != nil || resp.FinishReason != "length" {
+		t.Errorf("stream: finish reason %q, err %v", resp.FinishReason, err)
+	}
+	resp, err = chat.Stream(context.Background(), "three", func(string) {})
+	if err != nil || resp.FinishReason != "stop" {
+		t.Errorf("stream: finish reason %q, err %v", resp.FinishReason, err)
+	}
+}
+
+func TestStreamCutOff(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	fake.Enqueue(fakeprovider.Reply{
+		Headers: map[string]string{"Content-Type": "text/event-stream"},
+		Body:    `data: {"choices":[{"delta":{"content":"partial"}}]}` + "\n\n",
+	})
+	_, err := chat.Stream(context.Background(), "hi", func(string) {})
+	if !errors.Is(err, ErrNetwork) {
+		t.Errorf("err = %v, want a network error", err)
+	}
+	if len(chat.History()) != 0 {
+		t.Errorf("cut-off reply was kept: %+v", chat.History())
+	}
+}
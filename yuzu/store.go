@@ -0,0 +1,811 @@
+package yuzu
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store persists the current conversation window, the full message archive,
+// per-request metrics and attachments.
+type Store interface {
+	// LoadHistory returns the current session and its conversation window.
+	// A missing history yields an empty session ID and no error.
+	LoadHistory() (string, []Message, error)
+	SaveHistory(sessionID, model, provider string, messages []Message) error
+	ClearHistory() error
+	AppendArchive(messages ...Message) error
+	LoadArchive() ([]Message, error)
+	// SearchArchive returns up to limit archived messages matching query,
+	// newest first.
+	SearchArchive(query SearchQuery, limit int) ([]SearchHit, error)
+	RecordMetric(metric Metric) error
+	SaveAttachment(attachment Attachment) error
+	// LoadAttachments returns the attachments of a session, oldest first.
+	LoadAttachments(sessionID string) ([]Attachment, error)
+	Close() error
+}
+
+// Metric describes one completed request to a provider.
+type Metric struct {
+	Timestamp        string `json:"timestamp"`
+	Session          string `json:"session"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	DurationMs       int64  `json:"duration_ms"`
+	Streamed         bool   `json:"streamed"`
+}
+
+// Attachment is a file kept with a session.
+type Attachment struct {
+	Session   string
+	Name      string
+	MimeType  string
+	Data      []byte
+	CreatedAt string
+}
+
+// jsonStore is the original file layout: chat_history.json for the window,
+// chat_archive.jsonl for every message, metrics.jsonl and an attachments
+// directory.
+type jsonStore struct {
+	historyFile   string
+	archiveFile   string
+	metricsFile   string
+	attachmentDir string
+	logger        *slog.Logger
+}
+
+func newJSONStore(dir, historyFile string) *jsonStore {
+	return &jsonStore{
+		logger:        slog.New(slog.DiscardHandler),
+		historyFile:   historyFile,
+		archiveFile:   filepath.Join(dir, "chat_archive.jsonl"),
+		metricsFile:   filepath.Join(dir, "metrics.jsonl"),
+		attachmentDir: filepath.Join(dir, "attachments"),
+	}
+}
+
+func (s *jsonStore) LoadHistory() (string, []Message, error) {
+	data, err := os.ReadFile(s.historyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	sessionID, messages, err := parseHistory(data)
+	if err != nil {
+		s.logger.Error("parsing history", "path", s.historyFile, "error", err.Error())
+		if sessionID, messages, err = s.recoverHistory(); err != nil {
+			return "", nil, err
+		}
+	}
+	if _, err := os.Stat(s.archiveFile); os.IsNotExist(err) && len(messages) > 0 {
+		if err := s.AppendArchive(messages...); err != nil {
+			return "", nil, err
+		}
+	}
+	return sessionID, messages, nil
+}
+
+func parseHistory(data []byte) (string, []Message, error) {
+	var historyData struct {
+		Metadata struct {
+			SessionID string `json:"session_id"`
+		} `json:"metadata"`
+		Conversations []Message `json:"conversations"`
+	}
+	if err := json.Unmarshal(data, &historyData); err != nil {
+		return "", nil, err
+	}
+	sessionID := historyData.Metadata.SessionID
+	if sessionID == "" {
+		sessionID = newSessionID()
+		for i := range historyData.Conversations {
+			historyData.Conversations[i].Session = sessionID
+		}
+	}
+	return sessionID, historyData.Conversations, nil
+}
+
+// recoverHistory moves a corrupt history file aside and rebuilds the window
+// from its backup or, failing that, from the archive.
+func (s *jsonStore) recoverHistory() (string, []Message, error) {
+	corrupt := s.historyFile + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(s.historyFile, corrupt); err != nil {
+		return "", nil, err
+	}
+	s.logger.Warn("corrupt history moved aside", "path", corrupt)
+	if data, err := os.ReadFile(s.historyFile + ".bak"); err == nil {
+		if sessionID, messages, err := parseHistory(data); err == nil {
+			if err := writeFileAtomic(s.historyFile, data, 0644, false); err != nil {
+				return "", nil, err
+			}
+			s.logger.Info("history recovered from backup", "messages", len(messages))
+			return sessionID, messages, nil
+		}
+	}
+	archive, err := s.LoadArchive()
+	if err != nil || len(archive) == 0 {
+		return "", nil, err
+	}
+	sessionID := archive[len(archive)-1].Session
+	var messages []Message
+	for _, msg := range archive {
+		if msg.Session == sessionID {
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) > maxHistoryMessages {
+		messages = messages[len(messages)-maxHistoryMessages:]
+	}
+	if err := s.SaveHistory(sessionID, "", "", messages); err != nil {
+		return "", nil, err
+	}
+	s.logger.Info("history rebuilt from archive", "messages", len(messages))
+	return sessionID, messages, nil
+}
+
+func (s *jsonStore) SaveHistory(sessionID, model, provider string, messages []Message) error {
+	historyData := struct {
+		Metadata struct {
+			LastUpdated     string `json:"last_updated"`
+			TotalMessages   int    `json:"total_messages"`
+			CurrentModel    string `json:"current_model"`
+			CurrentProvider string `json:"current_provider"`
+			SessionID       string `json:"session_id"`
+		} `json:"metadata"`
+		Conversations []Message `json:"conversations"`
+	}{}
+	historyData.Metadata.LastUpdated = time.Now().Format(time.RFC3339)
+	historyData.Metadata.TotalMessages = len(messages)
+	historyData.Metadata.CurrentModel = model
+	historyData.Metadata.CurrentProvider = provider
+	historyData.Metadata.SessionID = sessionID
+	historyData.Conversations = messages
+	data, err := json.MarshalIndent(historyData, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.historyFile, data, 0644, true)
+}
+
+func (s *jsonStore) ClearHistory() error {
+	err := os.Remove(s.historyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func appendJSONLines(filename string, values ...interface{}) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonStore) AppendArchive(messages ...Message) error {
+	values := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		values[i] = msg
+	}
+	return appendJSONLines(s.archiveFile, values...)
+}
+
+func (s *jsonStore) LoadArchive() ([]Message, error) {
+	data, err := os.ReadFile(s.archiveFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var messages []Message
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *jsonStore) SearchArchive(query SearchQuery, limit int) ([]SearchHit, error) {
+	archive, err := s.LoadArchive()
+	if err != nil {
+		return nil, err
+	}
+	return searchMessages(archive, query, limit), nil
+}
+
+func (s *jsonStore) RecordMetric(metric Metric) error {
+	return appendJSONLines(s.metricsFile, metric)
+}
+
+func (s *jsonStore) SaveAttachment(attachment Attachment) error {
+	dir := filepath.Join(s.attachmentDir, attachment.Session)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, filepath.Base(attachment.Name)), attachment.Data, 0644, false)
+}
+
+// LoadAttachments reads the files saved for sessionID. The directory keeps
+// no MIME types, so they are guessed from the names and contents again.
+func (s *jsonStore) LoadAttachments(sessionID string) ([]Attachment, error) {
+	dir := filepath.Join(s.attachmentDir, sessionID)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, Attachment{
+			Session:   sessionID,
+			Name:      entry.Name(),
+			MimeType:  detectMimeType(entry.Name(), data),
+			Data:      data,
+			CreatedAt: info.ModTime().Format(time.RFC3339),
+		})
+	}
+	sort.SliceStable(attachments, func(i, j int) bool { return attachments[i].CreatedAt < attachments[j].CreatedAt })
+	return attachments, nil
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS state (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	model      TEXT NOT NULL DEFAULT '',
+	provider   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	content    TEXT NOT NULL,
+	timestamp  TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	provider   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_session ON messages(session_id);
+CREATE TABLE IF NOT EXISTS history (
+	position   INTEGER PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	content    TEXT NOT NULL,
+	timestamp  TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	provider   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS metrics (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp         TEXT NOT NULL,
+	session_id        TEXT NOT NULL,
+	provider          TEXT NOT NULL,
+	model             TEXT NOT NULL,
+	prompt_tokens     INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	duration_ms       INTEGER NOT NULL,
+	streamed          INTEGER NOT NULL
+);
+` + sqliteAttachmentsTable
+
+const sqliteAttachmentsTable = `
+CREATE TABLE IF NOT EXISTS attachments (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	mime_type  TEXT NOT NULL,
+	data       BLOB NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS attachments_session ON attachments(session_id);
+`
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how many
+// have run.
+var sqliteMigrations = []string{
+	sqliteSchema,
+	`ALTER TABLE messages ADD COLUMN msg_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE history ADD COLUMN msg_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE history ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE messages ADD COLUMN persona TEXT NOT NULL DEFAULT '';
+	ALTER TABLE history ADD COLUMN persona TEXT NOT NULL DEFAULT '';`,
+	// This migration used to drop the attachments table. It is kept in
+	// place so the numbering holds, and the next one restores the table in
+	// databases where the drop already ran.
+	sqliteAttachmentsTable,
+	sqliteAttachmentsTable,
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteStore keeps everything in one database so that each save is a single
+// transaction instead of a full rewrite of chat_history.json.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStore opens (or creates) the database at path. A fresh database is
+// seeded from the JSON files in legacy so existing history carries over.
+func openSQLiteStore(path string, legacy *jsonStore) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{"PRAGMA journal_mode=WAL", "PRAGMA busy_timeout=5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, sqliteError(err)
+		}
+	}
+	var check string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&check); err != nil || check != "ok" {
+		db.Close()
+		if err != nil {
+			return nil, sqliteError(err)
+		}
+		return nil, fmt.Errorf("%w: %s", errCorruptDatabase, check)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store := &sqliteStore{db: db}
+	if err := store.migrateFromJSON(legacy); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("importing JSON history: %v", err)
+	}
+	return store, nil
+}
+
+// errCorruptDatabase marks a database file SQLite cannot read.
+var errCorruptDatabase = errors.New("corrupt database")
+
+// sqliteError marks err as errCorruptDatabase when SQLite reports the file
+// is not a database or is malformed.
+func sqliteError(err error) error {
+	message := err.Error()
+	if strings.Contains(message, "not a database") || strings.Contains(message, "malformed") {
+		return fmt.Errorf("%w: %v", errCorruptDatabase, err)
+	}
+	return err
+}
+
+// recoverSQLiteStore moves a corrupt database and its WAL files aside, then
+// opens an empty one. The JSON files are not imported again: they stopped
+// being written when the database took over, so they would bring back a
+// stale conversation.
+func recoverSQLiteStore(path string, logger *slog.Logger) (*sqliteStore, error) {
+	corrupt := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(path, corrupt); err != nil {
+		return nil, err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(path+suffix, corrupt+suffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	logger.Warn("corrupt database moved aside, starting an empty one", "path", corrupt)
+	return openSQLiteStore(path, nil)
+}
+
+// migrateFromJSON imports the JSON files in legacy into a database that
+// holds no messages yet. It runs once per database: afterwards, or straight
+// away when legacy is nil, the state table records that it is done.
+func (s *sqliteStore) migrateFromJSON(legacy *jsonStore) error {
+	var imported string
+	err := s.db.QueryRow("SELECT value FROM state WHERE key = 'json_imported'").Scan(&imported)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 && legacy != nil {
+		if err := s.importJSON(legacy); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.Exec("INSERT INTO state (key, value) VALUES ('json_imported', ?)", time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (s *sqliteStore) importJSON(legacy *jsonStore) error {
+	sessionID, history, err := legacy.LoadHistory()
+	if err != nil {
+		return err
+	}
+	archive, err := legacy.LoadArchive()
+	if err != nil {
+		return err
+	}
+	if len(archive) == 0 && len(history) == 0 {
+		return nil
+	}
+	if err := s.AppendArchive(archive...); err != nil {
+		return err
+	}
+	legacy.logger.Info("imported JSON history", "messages", len(archive), "path", legacy.archiveFile)
+	if sessionID == "" {
+		return nil
+	}
+	return s.SaveHistory(sessionID, "", "", history)
+}
+
+func (s *sqliteStore) LoadHistory() (string, []Message, error) {
+	var sessionID string
+	err := s.db.QueryRow("SELECT value FROM state WHERE key = 'current_session'").Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	rows, err := s.db.Query("SELECT session_id, role, content, timestamp, model, provider, msg_id, parent_id, persona FROM history ORDER BY position")
+	if err != nil {
+		return "", nil, err
+	}
+	messages, err := scanMessages(rows)
+	return sessionID, messages, err
+}
+
+func scanMessages(rows *sql.Rows) ([]Message, error) {
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.Session, &msg.Role, &msg.Content, &msg.Timestamp, &msg.Model, &msg.Provider, &msg.ID, &msg.ParentID, &msg.Persona); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (s *sqliteStore) SaveHistory(sessionID, model, provider string, messages []Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Format(time.RFC3339)
+	if _, err := tx.Exec("INSERT INTO state (key, value) VALUES ('current_session', ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO sessions (id, created_at, updated_at, model, provider) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, model = excluded.model, provider = excluded.provider`,
+		sessionID, now, now, model, provider); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM history"); err != nil {
+		return err
+	}
+	for i, msg := range messages {
+		if _, err := tx.Exec("INSERT INTO history (position, session_id, role, content, timestamp, model, provider, msg_id, parent_id, persona) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			i, msg.Session, msg.Role, msg.Content, msg.Timestamp, msg.Model, msg.Provider, msg.ID, msg.ParentID, msg.Persona); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) ClearHistory() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM history"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM state WHERE key = 'current_session'"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) AppendArchive(messages ...Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Format(time.RFC3339)
+	for _, msg := range messages {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO sessions (id, created_at, updated_at) VALUES (?, ?, ?)", msg.Session, now, now); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO messages (session_id, role, content, timestamp, model, provider, msg_id, parent_id, persona) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			msg.Session, msg.Role, msg.Content, msg.Timestamp, msg.Model, msg.Provider, msg.ID, msg.ParentID, msg.Persona); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LoadArchive() ([]Message, error) {
+	rows, err := s.db.Query("SELECT session_id, role, content, timestamp, model, provider, msg_id, parent_id, persona FROM messages ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// SearchArchive leaves the role, session and plain search terms to SQLite so
+// that only candidate rows are read. Regular expressions and dates are checked
+// on those rows afterwards, as are terms LIKE cannot match case-insensitively.
+func (s *sqliteStore) SearchArchive(query SearchQuery, limit int) ([]SearchHit, error) {
+	var where []string
+	var args []interface{}
+	if query.Role != "" {
+		where = append(where, "role = ?")
+		args = append(args, query.Role)
+	}
+	if query.Session != "" {
+		where = append(where, "session_id = ?")
+		args = append(args, query.Session)
+	}
+	for _, filter := range []struct{ column, value string }{
+		{"model", query.Model}, {"provider", query.Provider},
+	} {
+		if filter.value != "" && isASCII(filter.value) {
+			where = append(where, filter.column+` LIKE ? ESCAPE '\'`)
+			args = append(args, likePattern(filter.value))
+		}
+	}
+	for _, term := range query.terms {
+		if isASCII(term) {
+			where = append(where, `content LIKE ? ESCAPE '\'`)
+			args = append(args, likePattern(term))
+		}
+	}
+	statement := "SELECT id, session_id, role, content, timestamp, model, provider, msg_id, parent_id, persona FROM messages"
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := s.db.Query(statement+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	var hits []SearchHit
+	var rowIDs []int64
+	for rows.Next() && len(hits) < limit {
+		var rowID int64
+		var msg Message
+		if err := rows.Scan(&rowID, &msg.Session, &msg.Role, &msg.Content, &msg.Timestamp, &msg.Model, &msg.Provider, &msg.ID, &msg.ParentID, &msg.Persona); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if query.Matches(msg) {
+			hits = append(hits, SearchHit{Message: msg})
+			rowIDs = append(rowIDs, rowID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	// Index is the position in LoadArchive, which is ordered by id.
+	for i, rowID := range rowIDs {
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM messages WHERE id < ?", rowID).Scan(&hits[i].Index); err != nil {
+			return nil, err
+		}
+	}
+	return hits, nil
+}
+
+// likePattern matches value anywhere in a column, with LIKE's wildcards in it
+// escaped.
+func likePattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+	return "%" + escaped + "%"
+}
+
+// isASCII reports whether LIKE, which folds case for ASCII letters only, can
+// match value the way the case-insensitive patterns do.
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sqliteStore) RecordMetric(metric Metric) error {
+	_, err := s.db.Exec(`INSERT INTO metrics (timestamp, session_id, provider, model, prompt_tokens, completion_tokens, duration_ms, streamed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		metric.Timestamp, metric.Session, metric.Provider, metric.Model,
+		metric.PromptTokens, metric.CompletionTokens, metric.DurationMs, metric.Streamed)
+	return err
+}
+
+func (s *sqliteStore) SaveAttachment(attachment Attachment) error {
+	_, err := s.db.Exec("INSERT INTO attachments (session_id, name, mime_type, data, created_at) VALUES (?, ?, ?, ?, ?)",
+		attachment.Session, attachment.Name, attachment.MimeType, attachment.Data, attachment.CreatedAt)
+	return err
+}
+
+func (s *sqliteStore) LoadAttachments(sessionID string) ([]Attachment, error) {
+	rows, err := s.db.Query("SELECT session_id, name, mime_type, data, created_at FROM attachments WHERE session_id = ? ORDER BY id", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var attachments []Attachment
+	for rows.Next() {
+		var attachment Attachment
+		if err := rows.Scan(&attachment.Session, &attachment.Name, &attachment.MimeType, &attachment.Data, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// openStore picks the backend named in profile.json ("sqlite" by default,
+// or "json"). A corrupt database is moved aside and started afresh; any other
+// failure to open it is returned.
+func (y *YuzuChat) openStore() error {
+	dir := filepath.Dir(y.historyFile)
+	legacy := newJSONStore(dir, y.historyFile)
+	legacy.logger = y.logger
+	if y.storageBackend == "json" {
+		y.store = legacy
+		return nil
+	}
+	path := filepath.Join(dir, "yuzuchat.db")
+	store, err := openSQLiteStore(path, legacy)
+	if errors.Is(err, errCorruptDatabase) {
+		y.logger.Error("opening SQLite storage", "error", err.Error())
+		store, err = recoverSQLiteStore(path, y.logger)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: opening %s: %w", ErrStorage, path, err)
+	}
+	y.store = store
+	return nil
+}
+
+func (y *YuzuChat) loadHistory() error {
+	sessionID, messages, err := y.store.LoadHistory()
+	if err != nil {
+		return fmt.Errorf("%w: loading history: %w", ErrStorage, err)
+	}
+	if sessionID == "" {
+		y.conversationHistory = []Message{}
+		y.sessionID = newSessionID()
+		return nil
+	}
+	linkMessages(messages, "")
+	y.conversationHistory = messages
+	y.sessionID = sessionID
+	return nil
+}
+
+func (y *YuzuChat) saveHistory() error {
+	if err := y.store.SaveHistory(y.sessionID, y.model, y.currentProvider, y.conversationHistory); err != nil {
+		y.logger.Error("saving history", "session", y.sessionID, "error", err.Error())
+		return fmt.Errorf("%w: history: %w", ErrStorage, err)
+	}
+	return nil
+}
+
+// ClearHistory starts a new, empty conversation. Archived messages are kept.
+func (y *YuzuChat) ClearHistory() error {
+	y.conversationHistory = []Message{}
+	y.sessionID = newSessionID()
+	return y.store.ClearHistory()
+}
+
+func newSessionID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// appendToArchive records messages in the archive, which unlike the
+// conversation window is never trimmed or cleared.
+func (y *YuzuChat) appendToArchive(messages ...Message) error {
+	if err := y.store.AppendArchive(messages...); err != nil {
+		y.logger.Error("writing archive", "messages", len(messages), "error", err.Error())
+		return fmt.Errorf("%w: archive: %w", ErrStorage, err)
+	}
+	return nil
+}
+
+func (y *YuzuChat) loadArchive() ([]Message, error) {
+	return y.store.LoadArchive()
+}
+
+func (y *YuzuChat) recordMetric(metric Metric) {
+	metric.Timestamp = time.Now().Format(time.RFC3339)
+	metric.Session = y.sessionID
+	if err := y.store.RecordMetric(metric); err != nil {
+		y.logger.Warn("recording metrics", "error", err.Error())
+	}
+}
@@ -0,0 +1,230 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestHistoryPersists(t *testing.T) {
+	for _, backend := range []string{"sqlite", "json"} {
+		t.Run(backend, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeFile(t, "cu.key", "test-key")
+			writeFile(t, "profile.json", `{"storage": "`+backend+`"}`)
+
+			chat := openChat(t, dir, fake)
+			for _, message := range []string{"one", "two"} {
+				if _, err := chat.Send(context.Background(), message); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sessionID := chat.SessionID()
+			chat.Close()
+
+			reopened := openChat(t, dir, fake)
+			defer reopened.Close()
+			history := reopened.History()
+			if len(history) != 4 || history[0].Content != "one" || history[3].Content != "echo: two" {
+				t.Fatalf("reloaded history = %+v", history)
+			}
+			if reopened.SessionID() != sessionID {
+				t.Errorf("session %s, want %s", reopened.SessionID(), sessionID)
+			}
+			for i := 1; i < len(history); i++ {
+				if history[i].ParentID != history[i-1].ID {
+					t.Errorf("message %d is not linked to the one before it", i)
+				}
+			}
+
+			if _, err := reopened.Send(context.Background(), "three"); err != nil {
+				t.Fatal(err)
+			}
+			if messages := fake.LastRequest().Messages; len(messages) != 5 {
+				t.Errorf("request after reload has %d messages, want 5", len(messages))
+			}
+		})
+	}
+}
+
+func TestClearHistory(t *testing.T) {
+	for _, backend := range []string{"sqlite", "json"} {
+		t.Run(backend, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeFile(t, "cu.key", "test-key")
+			writeFile(t, "profile.json", `{"storage": "`+backend+`"}`)
+
+			chat := openChat(t, dir, fake)
+			if _, err := chat.Send(context.Background(), "forget me"); err != nil {
+				t.Fatal(err)
+			}
+			oldSession := chat.SessionID()
+			if err := chat.ClearHistory(); err != nil {
+				t.Fatal(err)
+			}
+			if len(chat.History()) != 0 || chat.SessionID() == oldSession {
+				t.Errorf("history %+v in session %s after clearing", chat.History(), chat.SessionID())
+			}
+			chat.Close()
+
+			reopened := openChat(t, dir, fake)
+			defer reopened.Close()
+			if len(reopened.History()) != 0 {
+				t.Errorf("cleared history came back: %+v", reopened.History())
+			}
+			archive, err := reopened.loadArchive()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archive) != 2 {
+				t.Errorf("archive has %d messages, want 2", len(archive))
+			}
+		})
+	}
+}
+
+func TestCorruptHistoryIsRecovered(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	writeFile(t, "profile.json", `{"storage": "json"}`)
+
+	chat := openChat(t, dir, fake)
+	for _, message := range []string{"one", "two"} {
+		if _, err := chat.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat.Close()
+
+	// The backup holds the window as it was before the last save.
+	corrupt := func() {
+		if err := os.WriteFile("chat_history.json", []byte(`{"conversations": [`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupt()
+	reopened := openChat(t, dir, fake)
+	if n := len(reopened.History()); n != 2 {
+		t.Errorf("recovered %d messages from the backup, want 2", n)
+	}
+	reopened.Close()
+
+	corrupt()
+	os.Remove("chat_history.json.bak")
+	rebuilt := openChat(t, dir, fake)
+	defer rebuilt.Close()
+	if n := len(rebuilt.History()); n != 4 {
+		t.Errorf("rebuilt %d messages from the archive, want 4", n)
+	}
+}
+
+func TestCorruptDatabaseIsMovedAside(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	writeFile(t, "yuzuchat.db", strings.Repeat("not a database ", 512))
+	// Left over from before the database; it must not come back.
+	writeFile(t, "chat_history.json", `{"metadata": {"session_id": "stale"}, "conversations": [{"role": "user", "content": "old"}]}`)
+
+	chat := openChat(t, dir, fake)
+	if _, ok := chat.store.(*sqliteStore); !ok {
+		t.Fatalf("store is %T, want a new SQLite database", chat.store)
+	}
+	if n := len(chat.History()); n != 0 || chat.SessionID() == "stale" {
+		t.Fatalf("recovered database holds %d messages of session %s, want an empty one", n, chat.SessionID())
+	}
+	if _, err := chat.Send(context.Background(), "still here?"); err != nil {
+		t.Fatal(err)
+	}
+	chat.Close()
+	corrupt, _ := filepath.Glob("yuzuchat.db.corrupt-*")
+	if len(corrupt) != 1 {
+		t.Errorf("corrupt copies %v, want one", corrupt)
+	}
+	reopened := openChat(t, dir, fake)
+	defer reopened.Close()
+	if n := len(reopened.History()); n != 2 {
+		t.Errorf("%d messages after reopening, want 2", n)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	for _, backend := range []string{"sqlite", "json"} {
+		t.Run(backend, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeFile(t, "cu.key", "test-key")
+			writeFile(t, "profile.json", `{"storage": "`+backend+`"}`)
+			writeFile(t, "notes.txt", "remember the milk")
+
+			chat := openChat(t, dir, fake)
+			if _, err := chat.Send(context.Background(), "see the notes"); err != nil {
+				t.Fatal(err)
+			}
+			attachment, err := chat.Attach("notes.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attachment.Name != "notes.txt" || !strings.HasPrefix(attachment.MimeType, "text/plain") {
+				t.Errorf("attachment = %+v", attachment)
+			}
+			if _, err := chat.Attach("missing.txt"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("missing file: got %v, want ErrNotFound", err)
+			}
+			sessionID := chat.SessionID()
+			chat.Close()
+
+			reopened := openChat(t, dir, fake)
+			defer reopened.Close()
+			attachments, err := reopened.Attachments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(attachments) != 1 || string(attachments[0].Data) != "remember the milk" || attachments[0].Session != sessionID {
+				t.Fatalf("attachments after reopening = %+v", attachments)
+			}
+			reopened.ClearHistory()
+			if attachments, _ := reopened.Attachments(); len(attachments) != 0 {
+				t.Errorf("new session has attachments %+v", attachments)
+			}
+		})
+	}
+}
+
+func TestAttachmentsTableIsRestored(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "yuzuchat.db")
+	store, err := openSQLiteStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An earlier version dropped the table in migration 4.
+	for _, statement := range []string{"DROP TABLE attachments", "PRAGMA user_version = 4"} {
+		if _, err := store.db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = openSQLiteStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.SaveAttachment(Attachment{Session: "s", Name: "a.txt", MimeType: "text/plain", Data: []byte("a")}); err != nil {
+		t.Fatalf("attachments table not restored: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package yuzu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// PromptTemplate is a reusable prompt stored as a file in a templates
+// directory. Placeholders are written {{name}}; full text/template syntax
+// and {{include "file"}} also work.
+type PromptTemplate struct {
+	Name string
+	Path string
+}
+
+var templateExtensions = []string{".tmpl", ".txt", ".md"}
+
+// TemplateDirs lists where templates are looked up. Later directories win,
+// so a project template overrides one of the same name in the config
+// directory.
+func TemplateDirs() []string {
+	var dirs []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "yuzuchat", "templates"))
+	}
+	return append(dirs, "templates")
+}
+
+func ListTemplates() []PromptTemplate {
+	found := map[string]PromptTemplate{}
+	for _, dir := range TemplateDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || !contains(templateExtensions, ext) {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ext)
+			found[name] = PromptTemplate{Name: name, Path: filepath.Join(dir, entry.Name())}
+		}
+	}
+	var templates []PromptTemplate
+	for _, tpl := range found {
+		templates = append(templates, tpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var templateKeywords = []string{"end", "else", "nil", "break", "continue"}
+
+// Variables returns the {{name}} placeholders used by the template.
+func (t PromptTemplate) Variables() []string {
+	data, err := os.ReadFile(t.Path)
+	if err != nil {
+		return nil
+	}
+	var vars []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(string(data), -1) {
+		if !contains(templateKeywords, match[1]) && !contains(vars, match[1]) {
+			vars = append(vars, match[1])
+		}
+	}
+	return vars
+}
+
+func findTemplate(name string) (*PromptTemplate, error) {
+	for _, t := range ListTemplates() {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("template '%s' %w", name, ErrNotFound)
+}
+
+// SaveTemplate writes a template to the project templates directory,
+// replacing one of the same name there, and returns its path.
+func SaveTemplate(name, text string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid template name '%s'", name)
+	}
+	dirs := TemplateDirs()
+	dir := dirs[len(dirs)-1]
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, name+".tmpl")
+	if tpl, err := findTemplate(name); err == nil && filepath.Dir(tpl.Path) == dir {
+		filename = tpl.Path
+	}
+	if err := writeFileAtomic(filename, []byte(text), 0644, false); err != nil {
+		return "", fmt.Errorf("saving template: %w", err)
+	}
+	return filename, nil
+}
+
+// DeleteTemplate removes the file the named template is loaded from and
+// returns its path. A template of the same name in another directory takes
+// its place.
+func DeleteTemplate(name string) (string, error) {
+	tpl, err := findTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(tpl.Path); err != nil {
+		return "", fmt.Errorf("deleting template: %w", err)
+	}
+	return tpl.Path, nil
+}
+
+// RenderTemplate fills in the named template. A placeholder without a value
+// is an error rather than silently rendering empty.
+func RenderTemplate(name string, vars map[string]string) (string, error) {
+	tpl, err := findTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(tpl.Path)
+	if err != nil {
+		return "", err
+	}
+	source := placeholderPattern.ReplaceAllStringFunc(string(data), func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if contains(templateKeywords, name) {
+			return placeholder
+		}
+		return fmt.Sprintf("{{var %q}}", name)
+	})
+	funcs := template.FuncMap{
+		"var": func(key string) (string, error) {
+			value, ok := vars[key]
+			if !ok {
+				return "", fmt.Errorf("missing variable '%s'", key)
+			}
+			return value, nil
+		},
+		"include": func(path string) (string, error) {
+			if !filepath.IsAbs(path) {
+				if candidate := filepath.Join(filepath.Dir(tpl.Path), path); fileExists(candidate) {
+					path = candidate
+				}
+			}
+			data, err := os.ReadFile(path)
+			return string(data), err
+		},
+	}
+	parsed, err := template.New(name).Funcs(funcs).Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := parsed.Execute(&out, vars); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ParseTemplateVars turns key=value arguments into a variable map.
+func ParseTemplateVars(args []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("expected key=value, got '%s'", arg)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+var inlineTemplatePattern = regexp.MustCompile(`\{\{tpl:([^}]*)\}\}`)
+
+// ExpandInlineTemplates replaces {{tpl:name key=value ...}} in a chat
+// message with the rendered template.
+func ExpandInlineTemplates(input string) (string, error) {
+	var expandErr error
+	output := inlineTemplatePattern.ReplaceAllStringFunc(input, func(match string) string {
+		args := SplitArgs(inlineTemplatePattern.FindStringSubmatch(match)[1])
+		if len(args) == 0 {
+			expandErr = fmt.Errorf("empty template reference")
+			return match
+		}
+		vars, err := ParseTemplateVars(args[1:])
+		if err == nil {
+			var rendered string
+			if rendered, err = RenderTemplate(args[0], vars); err == nil {
+				return rendered
+			}
+		}
+		if expandErr == nil {
+			expandErr = err
+		}
+		return match
+	})
+	return output, expandErr
+}
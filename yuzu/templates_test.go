@@ -0,0 +1,142 @@
+package yuzu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// useTemplateDirs points the config and project template directories at
+// fresh temporary ones and returns the config one.
+func useTemplateDirs(t *testing.T) string {
+	t.Helper()
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	t.Chdir(t.TempDir())
+	dirs := TemplateDirs()
+	if len(dirs) != 2 {
+		t.Fatalf("template dirs = %v", dirs)
+	}
+	if err := os.MkdirAll(dirs[0], 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("templates", 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dirs[0]
+}
+
+func TestRenderTemplate(t *testing.T) {
+	configDir := useTemplateDirs(t)
+	writeFile(t, filepath.Join(configDir, "review.tmpl"), "global review")
+	writeFile(t, filepath.Join(configDir, "jp.txt"), "Translate to Japanese: {{text}}")
+	writeFile(t, "templates/review.md", `Review this {{ lang }} diff{{if .strict}} strictly{{end}}.
+{{include "rules.inc"}}{{text}}`)
+	writeFile(t, "templates/rules.inc", "No panics.\n")
+	writeFile(t, "templates/notes.json", "not a template")
+
+	var names []string
+	for _, tpl := range ListTemplates() {
+		names = append(names, tpl.Name)
+	}
+	if !slices.Equal(names, []string{"jp", "review"}) {
+		t.Fatalf("templates = %v", names)
+	}
+	review := ListTemplates()[1]
+	if review.Path != filepath.Join("templates", "review.md") {
+		t.Errorf("review loaded from %s, want the project template", review.Path)
+	}
+	if vars := review.Variables(); !slices.Equal(vars, []string{"lang", "text"}) {
+		t.Errorf("variables = %v", vars)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    string
+		wantErr string
+	}{
+		{"review", map[string]string{"lang": "Go", "text": "+x"}, "Review this Go diff.\nNo panics.\n+x", ""},
+		{"review", map[string]string{"lang": "Go", "text": "", "strict": "yes"}, "Review this Go diff strictly.\nNo panics.\n", ""},
+		{"review", map[string]string{"lang": "Go"}, "", "missing variable 'text'"},
+		{"jp", map[string]string{"text": "good morning"}, "Translate to Japanese: good morning", ""},
+		{"jp", map[string]string{"txt": "good morning"}, "", "missing variable 'text'"},
+		{"ghost", nil, "", "template 'ghost' not found"},
+	}
+	for _, tt := range tests {
+		got, err := RenderTemplate(tt.name, tt.vars)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RenderTemplate(%s, %v) = %q, %v; want an error containing %q", tt.name, tt.vars, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("RenderTemplate(%s, %v) = %q, %v; want %q", tt.name, tt.vars, got, err, tt.want)
+		}
+	}
+	if _, err := RenderTemplate("ghost", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown template: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpandInlineTemplates(t *testing.T) {
+	useTemplateDirs(t)
+	writeFile(t, "templates/jp.tmpl", "Translate to Japanese: {{text}}")
+	got, err := ExpandInlineTemplates(`please {{tpl:jp "text=good morning"}} and {{name}}`)
+	if err != nil || got != "please Translate to Japanese: good morning and {{name}}" {
+		t.Errorf("expanded = %q, %v", got, err)
+	}
+	for _, input := range []string{"{{tpl:jp}}", "{{tpl:jp text}}", "{{tpl:ghost}}", "{{tpl: }}"} {
+		if got, err := ExpandInlineTemplates(input); err == nil || got != input {
+			t.Errorf("%s expanded to %q, %v; want it left alone with an error", input, got, err)
+		}
+	}
+}
+
+func TestSaveAndDeleteTemplate(t *testing.T) {
+	configDir := useTemplateDirs(t)
+	writeFile(t, filepath.Join(configDir, "greet.tmpl"), "Hello from config, {{name}}")
+
+	path, err := SaveTemplate("greet", "Hi {{name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join("templates", "greet.tmpl") {
+		t.Errorf("saved to %s", path)
+	}
+	if got, err := RenderTemplate("greet", map[string]string{"name": "Yuzu"}); err != nil || got != "Hi Yuzu" {
+		t.Errorf("rendered %q, %v", got, err)
+	}
+
+	writeFile(t, "templates/review.md", "old")
+	if path, err := SaveTemplate("review", "new"); err != nil || path != filepath.Join("templates", "review.md") {
+		t.Errorf("resaving review went to %s, %v; want the existing file replaced", path, err)
+	}
+	if got, _ := RenderTemplate("review", nil); got != "new" {
+		t.Errorf("review = %q after saving", got)
+	}
+
+	if path, err := DeleteTemplate("greet"); err != nil || path != filepath.Join("templates", "greet.tmpl") {
+		t.Fatalf("deleted %s, %v", path, err)
+	}
+	if got, err := RenderTemplate("greet", map[string]string{"name": "Yuzu"}); err != nil || got != "Hello from config, Yuzu" {
+		t.Errorf("after deleting the project template rendered %q, %v", got, err)
+	}
+	if _, err := DeleteTemplate("greet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteTemplate("greet"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+	}
+
+	for _, name := range []string{"", "../escape", ".hidden", "a/b"} {
+		if _, err := SaveTemplate(name, "x"); err == nil {
+			t.Errorf("template name %q accepted", name)
+		}
+	}
+}
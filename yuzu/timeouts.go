@@ -0,0 +1,168 @@
+package yuzu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timeouts bound the phases of a provider request separately, so a long
+// answer keeps streaming for as long as chunks arrive. Zero disables a limit.
+type Timeouts struct {
+	// Connect covers dialling and the TLS handshake.
+	Connect time.Duration
+	// FirstByte runs from sending the request to the first byte of the
+	// reply body, which includes a reasoning model's thinking time and, for
+	// a request that is not streamed, the whole answer.
+	FirstByte time.Duration
+	// Idle is the longest gap allowed between chunks after the first.
+	Idle time.Duration
+}
+
+// DefaultTimeouts apply to providers without overrides in profile.json.
+var DefaultTimeouts = Timeouts{
+	Connect:   10 * time.Second,
+	FirstByte: 2 * time.Minute,
+	Idle:      time.Minute,
+}
+
+// SetTimeouts replaces a provider's timeouts for this session.
+func (y *YuzuChat) SetTimeouts(providerName string, timeouts Timeouts) error {
+	provider, exists := y.providers[providerName]
+	if !exists {
+		return fmt.Errorf("provider '%s' %w", providerName, ErrNotFound)
+	}
+	provider.Timeouts = timeouts
+	return nil
+}
+
+// timeoutError is the cause of a request cancelled by one of its limits.
+type timeoutError struct {
+	setting string // the profile.json setting that controls the limit
+	limit   time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	switch e.setting {
+	case "connect_timeout":
+		return fmt.Sprintf("no connection within %s (connect_timeout)", e.limit)
+	case "first_byte_timeout":
+		return fmt.Sprintf("no reply within %s (first_byte_timeout)", e.limit)
+	}
+	return fmt.Sprintf("stream stalled, no data for %s (idle_timeout)", e.limit)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return ErrTimeout
+}
+
+// requestTimer cancels a request when a phase runs over its limit. The
+// connect timer runs alongside the reply timer, which is first the
+// first-byte limit and then restarts with the idle limit on every chunk.
+type requestTimer struct {
+	mu      sync.Mutex
+	cancel  context.CancelCauseFunc
+	connect *time.Timer
+	reply   *time.Timer
+}
+
+func (t *requestTimer) start(timer **time.Timer, limit time.Duration, setting string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if limit > 0 {
+		cause := &timeoutError{setting: setting, limit: limit}
+		*timer = time.AfterFunc(limit, func() { t.cancel(cause) })
+	}
+}
+
+func (t *requestTimer) stopConnect() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.connect != nil {
+		t.connect.Stop()
+	}
+}
+
+func (t *requestTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, timer := range []*time.Timer{t.connect, t.reply} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// send performs a provider request under the provider's timeouts instead of
+// a deadline for the whole exchange. The connect limit only applies where
+// the transport dials, so replayed cassettes are not affected by it. A
+// request cut short by a limit fails with a timeoutError, which
+// networkError reports as ErrTimeout.
+func (y *YuzuChat) send(providerName string, req *http.Request) (*http.Response, error) {
+	timeouts := DefaultTimeouts
+	if provider, exists := y.providers[providerName]; exists {
+		timeouts = provider.Timeouts
+	}
+	ctx, cancel := context.WithCancelCause(withProvider(req.Context(), providerName))
+	timer := &requestTimer{cancel: cancel}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) { timer.start(&timer.connect, timeouts.Connect, "connect_timeout") },
+		GotConn: func(httptrace.GotConnInfo) { timer.stopConnect() },
+	}
+	timer.start(&timer.reply, timeouts.FirstByte, "first_byte_timeout")
+	resp, err := y.httpClient(0).Do(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		timer.stop()
+		cause := context.Cause(ctx)
+		cancel(nil)
+		if timeout, ok := cause.(*timeoutError); ok {
+			return nil, timeout
+		}
+		return nil, err
+	}
+	resp.Body = &timedBody{body: resp.Body, ctx: ctx, cancel: cancel, timer: timer, idle: timeouts.Idle}
+	return resp, nil
+}
+
+// timedBody restarts the idle limit whenever data arrives and turns a read
+// broken off by a limit into its timeoutError.
+type timedBody struct {
+	body   io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	timer  *requestTimer
+	idle   time.Duration
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.timer.start(&b.timer.reply, b.idle, "idle_timeout")
+	}
+	if err == io.EOF {
+		b.timer.stop()
+	} else if err != nil {
+		if timeout, ok := context.Cause(b.ctx).(*timeoutError); ok {
+			return n, timeout
+		}
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	if b.ctx.Err() == nil {
+		drainBody(b.body)
+	}
+	b.timer.stop()
+	err := b.body.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,106 @@
+package yuzu
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestLongStreamOutlastsTimeouts(t *testing.T) {
+	fake := fakeprovider.New(t)
+	chat := newTestChat(t, fake)
+	chat.SetTimeouts("chutes", Timeouts{Connect: time.Second, FirstByte: 300 * time.Millisecond, Idle: 150 * time.Millisecond})
+	fake.Enqueue(fakeprovider.Reply{Chunks: []string{"a", "b", "c", "d", "e", "f"}, ChunkDelay: 80 * time.Millisecond})
+	resp, err := chat.Stream(context.Background(), "long answer", func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "abcdef" || resp.Duration < 400*time.Millisecond {
+		t.Errorf("content %q after %s", resp.Content, resp.Duration)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		reply    fakeprovider.Reply
+		stream   bool
+		want     string
+	}{
+		{
+			name:     "stalled stream",
+			timeouts: Timeouts{Idle: 100 * time.Millisecond},
+			reply:    fakeprovider.Reply{Chunks: []string{"a", "b"}, ChunkDelay: time.Second},
+			stream:   true,
+			want:     "stream stalled, no data for 100ms (idle_timeout)",
+		},
+		{
+			name:     "slow first byte",
+			timeouts: Timeouts{FirstByte: 100 * time.Millisecond},
+			reply:    fakeprovider.Reply{Content: "late", Delay: time.Second},
+			want:     "no reply within 100ms (first_byte_timeout)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeprovider.New(t)
+			chat := newTestChat(t, fake)
+			chat.SetTimeouts("chutes", tt.timeouts)
+			fake.Enqueue(tt.reply)
+			var err error
+			if tt.stream {
+				_, err = chat.Stream(context.Background(), "hi", func(string) {})
+			} else {
+				_, err = chat.Send(context.Background(), "hi")
+			}
+			if !errors.Is(err, ErrTimeout) || errors.Is(err, ErrNetwork) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want a timeout: %s", err, tt.want)
+			}
+			if len(chat.History()) != 0 {
+				t.Errorf("timed out reply was kept: %+v", chat.History())
+			}
+		})
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// A listener that never accepts leaves the TLS handshake hanging.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	chat := newTestChat(t, fakeprovider.New(t))
+	chat.SetBaseURL("chutes", "https://"+listener.Addr().String()+"/v1")
+	chat.SetTimeouts("chutes", Timeouts{Connect: 100 * time.Millisecond, FirstByte: 5 * time.Second})
+	_, err = chat.Send(context.Background(), "hi")
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "connect_timeout") {
+		t.Errorf("err = %v, want a connect timeout", err)
+	}
+}
+
+func TestProviderTimeoutsFromProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "profile.json", `{"providers": {
+		"chutes": {"idle_timeout": "5m", "connect_timeout": "0"}
+	}}`)
+	chat := openChat(t, dir, fakeprovider.New(t))
+	defer chat.Close()
+	chutes, _ := chat.Provider("chutes")
+	want := Timeouts{Connect: 0, FirstByte: DefaultTimeouts.FirstByte, Idle: 5 * time.Minute}
+	if chutes.Timeouts != want {
+		t.Errorf("chutes timeouts = %+v, want %+v", chutes.Timeouts, want)
+	}
+	for _, name := range []string{"cerebras", "openrouter"} {
+		if provider, _ := chat.Provider(name); provider.Timeouts != DefaultTimeouts {
+			t.Errorf("%s timeouts = %+v, want the defaults", name, provider.Timeouts)
+		}
+	}
+}
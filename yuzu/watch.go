@@ -0,0 +1,236 @@
+package yuzu
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pollInterval is how often directories are rescanned without fsnotify.
+var pollInterval = 2 * time.Second
+
+// watchDirs reports files in dirs that change on disk and match interesting.
+// Directories rather than files are watched so that editors which save by
+// renaming a new file into place are still noticed. Bursts of events are
+// coalesced, and if fsnotify is unavailable the directories are polled.
+// Calling stop ends the watch; the channel is left open but stays quiet.
+func watchDirs(dirs []string, interesting func(path string) bool, logger *slog.Logger) (changes <-chan string, stop func()) {
+	out := make(chan string, 16)
+	done := make(chan struct{})
+	stop = sync.OnceFunc(func() { close(done) })
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		for _, dir := range dirs {
+			if err = watcher.Add(dir); err != nil {
+				watcher.Close()
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.Warn("file watching unavailable, polling for changes instead", "error", err.Error())
+		go pollDirs(dirs, interesting, out, done)
+		return out, stop
+	}
+	go func() {
+		defer watcher.Close()
+		pending := map[string]bool{}
+		var flush <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if interesting(event.Name) {
+					pending[event.Name] = true
+					flush = time.After(200 * time.Millisecond)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-flush:
+				for path := range pending {
+					if !send(out, path, done) {
+						return
+					}
+				}
+				pending = map[string]bool{}
+				flush = nil
+			}
+		}
+	}()
+	return out, stop
+}
+
+// send hands path to changes unless done is closed first.
+func send(changes chan<- string, path string, done <-chan struct{}) bool {
+	select {
+	case changes <- path:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func pollDirs(dirs []string, interesting func(path string) bool, changes chan<- string, done <-chan struct{}) {
+	snapshot := func() map[string]string {
+		state := map[string]string{}
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				path := filepath.Join(dir, entry.Name())
+				if !interesting(path) {
+					continue
+				}
+				if info, err := entry.Info(); err == nil {
+					state[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+				}
+			}
+		}
+		return state
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	previous := snapshot()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		current := snapshot()
+		for path, stamp := range current {
+			if previous[path] != stamp && !send(changes, path, done) {
+				return
+			}
+		}
+		for path := range previous {
+			if _, exists := current[path]; !exists && !send(changes, path, done) {
+				return
+			}
+		}
+		previous = current
+	}
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// WatchConfigFiles starts watching system.txt, profile.json, the key files
+// and personas. Changed paths are handed to ReloadChangedFile by the REPL so
+// reloads happen on the same goroutine as everything else. The watch lasts
+// until stop or Close is called; starting another one stops the previous.
+func (y *YuzuChat) WatchConfigFiles() (changes <-chan string, stop func()) {
+	names := map[string]bool{
+		filepath.Base(y.systemFile):  true,
+		filepath.Base(y.profileFile): true,
+	}
+	for _, provider := range y.providers {
+		names[filepath.Base(provider.KeyFile)] = true
+	}
+	dirs := []string{filepath.Dir(y.systemFile)}
+	if filepath.Dir(y.profileFile) != dirs[0] {
+		dirs = append(dirs, filepath.Dir(y.profileFile))
+	}
+	if err := os.MkdirAll(y.personasDir, 0755); err == nil {
+		dirs = append(dirs, y.personasDir)
+	}
+	personasDir, _ := filepath.Abs(y.personasDir)
+	if y.stopWatching != nil {
+		y.stopWatching()
+	}
+	changes, y.stopWatching = watchDirs(dirs, func(path string) bool {
+		if abs, err := filepath.Abs(filepath.Dir(path)); err == nil && abs == personasDir {
+			return strings.HasSuffix(path, ".json")
+		}
+		return names[filepath.Base(path)]
+	}, y.logger)
+	return changes, y.stopWatching
+}
+
+// Reload describes a watched file that was reloaded.
+type Reload struct {
+	Path string
+	// Kind is "system", "profile", "persona" or "key"; it is empty when
+	// nothing was reloaded.
+	Kind string
+	// Name is the persona or the provider whose key changed.
+	Name string
+	// Removed is set when a key file was emptied or deleted.
+	Removed bool
+}
+
+// ReloadChangedFile re-reads a watched file. It returns a zero Reload when
+// the contents match what is already loaded, as after our own writes, or the
+// file is not one it loads. On error the previous settings stay in place,
+// except that the valid settings of a profile with some bad ones are applied.
+func (y *YuzuChat) ReloadChangedFile(path string) (Reload, error) {
+	switch {
+	case samePath(path, y.systemFile):
+		data, err := os.ReadFile(y.systemFile)
+		if (err == nil && string(data) == y.systemPrompt) || (os.IsNotExist(err) && y.systemPrompt == "") {
+			return Reload{}, nil
+		}
+		if _, err := y.ReloadSystemPrompt(); err != nil {
+			return Reload{}, err
+		}
+		return Reload{Path: y.systemFile, Kind: "system"}, nil
+	case samePath(path, y.profileFile):
+		// Any edit reloads the whole profile, so no setting can be missed.
+		// A half-written file is left for the write that completes it.
+		data, err := os.ReadFile(y.profileFile)
+		if err != nil || string(data) == y.profileContents || !json.Valid(data) {
+			return Reload{}, nil
+		}
+		if err := y.loadProfile(); err != nil {
+			return Reload{}, err
+		}
+		return Reload{Path: y.profileFile, Kind: "profile"}, nil
+	case y.persona != nil && samePath(filepath.Dir(path), y.personasDir):
+		filename, err := y.personaFile(y.persona.Name)
+		if err != nil || !samePath(path, filename) {
+			return Reload{}, nil
+		}
+		persona, err := y.loadPersona(y.persona.Name)
+		if err != nil {
+			return Reload{}, fmt.Errorf("persona '%s' changed on disk but could not be loaded: %w", y.persona.Name, err)
+		}
+		before, _ := json.Marshal(y.persona)
+		after, _ := json.Marshal(persona)
+		if string(before) == string(after) {
+			return Reload{}, nil
+		}
+		y.persona = persona
+		return Reload{Path: filename, Kind: "persona", Name: persona.Name}, nil
+	}
+	for name, provider := range y.providers {
+		if !samePath(path, provider.KeyFile) {
+			continue
+		}
+		apiKey := y.loadKeyFile(provider.KeyFile)
+		if apiKey == provider.APIKey {
+			return Reload{}, nil
+		}
+		provider.APIKey = apiKey
+		provider.IsEnabled = apiKey != ""
+		return Reload{Path: provider.KeyFile, Kind: "key", Name: name, Removed: apiKey == ""}, nil
+	}
+	return Reload{}, nil
+}
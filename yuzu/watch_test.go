@@ -0,0 +1,114 @@
+package yuzu
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+func TestReloadChangedProfile(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	chat.SetAutoContinue(true)
+	if reload, err := chat.ReloadChangedFile(chat.profileFile); reload.Kind != "" || err != nil {
+		t.Errorf("our own write was reloaded: %+v, %v", reload, err)
+	}
+	data, err := os.ReadFile(chat.profileFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edit := range []struct {
+		setting string
+		applied func() bool
+	}{
+		{`"log_level": "debug"`, func() bool { return chat.LogLevel() == "debug" }},
+		{`"max_continuations": 5`, func() bool { return chat.maxContinuations == 5 }},
+	} {
+		edited := strings.Replace(string(data), "{", "{"+edit.setting+",", 1)
+		writeFile(t, chat.profileFile, edited[:len(edited)/2])
+		if reload, _ := chat.ReloadChangedFile(chat.profileFile); reload.Kind != "" {
+			t.Errorf("half-written profile was reloaded: %+v", reload)
+		}
+		writeFile(t, chat.profileFile, edited)
+		if reload, err := chat.ReloadChangedFile(chat.profileFile); reload.Kind != "profile" || err != nil {
+			t.Errorf("editing %s: reload %+v, %v", edit.setting, reload, err)
+		}
+		if !edit.applied() {
+			t.Errorf("%s was not applied", edit.setting)
+		}
+	}
+	// Each edit starts from the saved profile, so the second one took
+	// log_level out again.
+	if chat.LogLevel() != "info" {
+		t.Errorf("log level %s after it was removed from the profile", chat.LogLevel())
+	}
+}
+
+func TestWatchStops(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "system.txt")
+	interesting := func(path string) bool { return filepath.Base(path) == "system.txt" }
+	expect := func(changes <-chan string, want bool) {
+		t.Helper()
+		writeFile(t, target, time.Now().String())
+		select {
+		case path := <-changes:
+			if !want {
+				t.Errorf("%s reported after the watch stopped", path)
+			} else if path != target {
+				t.Errorf("reported %s, want %s", path, target)
+			}
+		case <-time.After(time.Second):
+			if want {
+				t.Error("change not reported")
+			}
+		}
+	}
+
+	changes, stop := watchDirs([]string{dir}, interesting, slog.New(slog.DiscardHandler))
+	expect(changes, true)
+	stop()
+	stop()
+	expect(changes, false)
+
+	previous := pollInterval
+	pollInterval = 50 * time.Millisecond
+	t.Cleanup(func() { pollInterval = previous })
+	polled := make(chan string, 16)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		pollDirs([]string{dir}, interesting, polled, done)
+		close(finished)
+	}()
+	time.Sleep(2 * pollInterval)
+	expect(polled, true)
+	close(done)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("polling did not stop")
+	}
+}
+
+func TestCloseStopsWatching(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	changes, _ := chat.WatchConfigFiles()
+	writeFile(t, chat.systemFile, "first")
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
+	}
+	chat.Close()
+	writeFile(t, chat.systemFile, "second")
+	select {
+	case path := <-changes:
+		t.Errorf("%s reported after Close", path)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,723 @@
+// Package yuzu is the multi-provider chat client behind yuzuchat: providers
+// and API keys, profile and system prompt, conversation history with its
+// archive and branches, and the Send API.
+//
+// ©2025 hkkm project | built with love 💕
+// guthib.com/icedeyes12
+
+package yuzu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Message struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Timestamp string `json:"timestamp"`
+	Model     string `json:"model"`
+	Provider  string `json:"provider"`
+	Session   string `json:"session,omitempty"`
+	ID        string `json:"id,omitempty"`
+	ParentID  string `json:"parent_id,omitempty"`
+	Persona   string `json:"persona,omitempty"`
+}
+
+type AIProvider struct {
+	Name    string
+	BaseURL string
+	// CheckURL is requested with a key to validate it, so it must be an
+	// endpoint that refuses bad keys.
+	CheckURL  string
+	APIKey    string
+	Models    []string
+	IsEnabled bool
+	KeyFile   string
+	// ResponseFormats lists the response_format types the API accepts.
+	ResponseFormats []string
+	// Proxy overrides the network proxy for this provider: a URL, or
+	// "direct" for none. Empty uses the network settings.
+	Proxy string
+	// AssistantPrefill is set when the API continues a trailing assistant
+	// message instead of starting a new one.
+	AssistantPrefill bool
+	Timeouts         Timeouts
+}
+
+// KeyCheck is the outcome of probing a provider with an API key.
+type KeyCheck struct {
+	Provider string
+	Status   string // "valid", "invalid", "low_credit" or "unknown"
+	Detail   string
+}
+
+const lowCreditThreshold = 0.5
+
+const maxHistoryMessages = 20
+
+type YuzuChat struct {
+	providers           map[string]*AIProvider
+	currentProvider     string
+	checkKeysOnStartup  bool
+	historyFile         string
+	storageBackend      string
+	store               Store
+	lockFile            string
+	instanceLock        *os.File
+	personasDir         string
+	persona             *Persona
+	stopWatching        func()
+	profileFile         string
+	systemFile          string
+	conversationHistory []Message
+	systemPrompt        string
+	model               string
+	sessionID           string
+	lastSearch          []SearchHit
+	jsonMode            bool
+	jsonRetries         int
+	schema              *ResponseSchema
+	transport           http.RoundTripper
+	debugOutput         io.Writer
+	logger              *slog.Logger
+	logLevel            *slog.LevelVar
+	logPath             string
+	profileLogLevel     string
+	profileContents     string // profile.json as last loaded or saved
+	providerSettings    map[string]providerSettings
+	network             Network
+	profileNetwork      Network
+	pool                *sharedTransport
+	autoContinue        bool
+	maxContinuations    int
+	logFile             io.Closer
+}
+
+// Client is the name YuzuChat goes by when embedded in other programs.
+type Client = YuzuChat
+
+// New loads providers, keys, profile, system prompt and history from the
+// given files and the directory around them. It fails when the profile is
+// invalid or the history cannot be opened, rather than starting on defaults
+// that would overwrite it.
+func New(historyFile, profileFile, systemFile string) (*YuzuChat, error) {
+	chat := &YuzuChat{
+		historyFile:      historyFile,
+		lockFile:         filepath.Join(filepath.Dir(historyFile), "yuzuchat.lock"),
+		personasDir:      filepath.Join(filepath.Dir(historyFile), "personas"),
+		profileFile:      profileFile,
+		systemFile:       systemFile,
+		providers:        make(map[string]*AIProvider),
+		currentProvider:  "chutes",
+		model:            "deepseek-ai/DeepSeek-V3-0324",
+		jsonRetries:      DefaultJSONRetries,
+		maxContinuations: DefaultMaxContinuations,
+	}
+	transport, _ := chat.newHTTPTransport(Network{})
+	chat.pool = &sharedTransport{current: transport}
+	if err := chat.openLog(); err != nil {
+		return nil, err
+	}
+	if err := chat.start(); err != nil {
+		chat.logger.Error("starting client", "error", err.Error())
+		if chat.store != nil {
+			chat.store.Close()
+		}
+		chat.releaseInstanceLock()
+		chat.closeLog()
+		return nil, err
+	}
+	chat.logger.Info("client started", "provider", chat.currentProvider, "model", chat.model,
+		"session", chat.sessionID, "messages", len(chat.conversationHistory))
+	return chat, nil
+}
+
+// start loads everything New promises, stopping at the first failure.
+func (y *YuzuChat) start() error {
+	if err := y.acquireInstanceLock(); err != nil {
+		return err
+	}
+	y.loadProviders()
+	if err := y.loadProfile(); err != nil {
+		return err
+	}
+	if _, err := y.ReloadSystemPrompt(); err != nil {
+		return fmt.Errorf("loading system prompt: %w", err)
+	}
+	if err := y.openStore(); err != nil {
+		return err
+	}
+	return y.loadHistory()
+}
+
+func (y *YuzuChat) loadProviders() {
+	y.providers["chutes"] = &AIProvider{
+		Name:    "Chutes AI",
+		BaseURL: "https://llm.chutes.ai/v1/chat/completions",
+		// The model list is public, so only a chat request proves a key.
+		CheckURL: "https://llm.chutes.ai/v1/chat/completions",
+		KeyFile:  "cu.key",
+		Models: []string{
+			"deepseek-ai/DeepSeek-V3-0324",
+			"deepseek-ai/DeepSeek-V3.1-Terminus",
+			"tngtech/DeepSeek-R1T-Chimera",
+			"tngtech/DeepSeek-R1T2-Chimera",
+			"Qwen/Qwen3-235B-A22B-Instruct",
+			"Qwen/Qwen3-VL-235B-A22B-Thinking",
+			"Qwen/Qwen3-Coder-480B-A35B-Instruct-FP8",
+			"zai-org/GLM-4.5-FP8",
+			"zai-org/GLM-4.6-FP8",
+			"deepseek-ai/DeepSeek-R1",
+		},
+		ResponseFormats: []string{"json_object", "json_schema"},
+	}
+	y.providers["openrouter"] = &AIProvider{
+		Name:     "OpenRouter",
+		BaseURL:  "https://openrouter.ai/api/v1/chat/completions",
+		CheckURL: "https://openrouter.ai/api/v1/key",
+		KeyFile:  "or.key",
+		// OpenRouter documents prefill for every model it routes to.
+		AssistantPrefill: true,
+		Models: []string{
+			"tngtech/deepseek-r1t2-chimera:free",
+			"z_ai/glm-4.5-air:free",
+			"tngtech/deepseek-r1t-chimera:free",
+			"deepseek/deepseek-v3:free",
+			"deepseek/r1:free",
+			"qwen/qwen3-235b-a22b:free",
+			"meituan/longcat-flash-chat:free",
+		},
+		ResponseFormats: []string{"json_object", "json_schema"},
+	}
+	y.providers["cerebras"] = &AIProvider{
+		Name:     "Cerebras",
+		BaseURL:  "https://api.cerebras.ai/v1/chat/completions",
+		CheckURL: "https://api.cerebras.ai/v1/models",
+		KeyFile:  "ce.key",
+		Models: []string{
+			"qwen-3-235b-a22b-instruct-2507",
+			"qwen-3-235b-a22b-thinking-2507",
+			"qwen-3-coder-480b",
+			"qwen-3-32b",
+			"gpt-oss-120b",
+			"llama-3.3-70b",
+			"llama-4-scout-17b-16e-instruct",
+			"llama3.1-8b",
+		},
+		ResponseFormats: []string{"json_object", "json_schema"},
+	}
+	for name, provider := range y.providers {
+		provider.Timeouts = DefaultTimeouts
+		provider.APIKey = y.loadKeyFile(provider.KeyFile)
+		provider.IsEnabled = provider.APIKey != ""
+		y.logger.Debug("provider loaded", "provider", name, "key_file", provider.KeyFile, "enabled", provider.IsEnabled)
+	}
+}
+
+func (y *YuzuChat) loadKeyFile(filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (y *YuzuChat) saveKeyFile(filename, apiKey string) error {
+	return writeFileAtomic(filename, []byte(apiKey), 0600, false)
+}
+
+func (y *YuzuChat) removeKeyFile(filename string) error {
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic replaces filename via a synced temp file and a rename, so a
+// crash leaves either the old or the new contents, never a truncated file.
+// With backup the previous version is kept as filename.bak.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode, backup bool) error {
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if backup {
+		if err := backupFile(filename); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupFile keeps the current contents of filename as filename.bak,
+// hard-linking where possible so the copy is free.
+func backupFile(filename string) error {
+	bak := filename + ".bak"
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	os.Remove(bak)
+	if err := os.Link(filename, bak); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bak, data, 0644)
+}
+
+// errLockHeld is returned by lockFile when another process has the lock.
+var errLockHeld = errors.New("lock held by another process")
+
+// acquireInstanceLock takes an exclusive lock on the lock file next to the
+// state files and holds it until Close, since two instances would overwrite
+// each other's history. The operating system drops the lock when the process
+// dies, so a crash leaves nothing stale behind. The file also names the PID
+// of the holder, for the error another instance gets.
+func (y *YuzuChat) acquireInstanceLock() error {
+	f, err := os.OpenFile(y.lockFile, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if !errors.Is(err, errLockHeld) {
+			return fmt.Errorf("locking %s: %w", y.lockFile, err)
+		}
+		holder := ""
+		if data, err := os.ReadFile(y.lockFile); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			holder = fmt.Sprintf(" (PID %s)", strings.TrimSpace(string(data)))
+		}
+		return fmt.Errorf("%s is %w%s", filepath.Dir(y.lockFile), ErrInUse, holder)
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	y.instanceLock = f
+	return nil
+}
+
+// releaseInstanceLock closes the lock file, which releases the lock. The
+// file stays, so another instance waiting on it locks the same file.
+func (y *YuzuChat) releaseInstanceLock() {
+	if y.instanceLock != nil {
+		y.instanceLock.Close()
+		y.instanceLock = nil
+	}
+}
+
+// loadProfile applies profile.json. A missing file leaves the defaults; one
+// that cannot be read or parsed changes nothing. Settings that are wrong are
+// skipped and reported together in the error.
+func (y *YuzuChat) loadProfile() error {
+	data, err := os.ReadFile(y.profileFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("loading profile: %w", err)
+	}
+	var profileData struct {
+		Model              string                      `json:"model"`
+		Provider           string                      `json:"provider"`
+		CheckKeysOnStartup bool                        `json:"check_keys_on_startup"`
+		Storage            string                      `json:"storage"`
+		Persona            string                      `json:"persona"`
+		LogLevel           string                      `json:"log_level"`
+		Providers          map[string]providerSettings `json:"providers"`
+		AutoContinue       bool                        `json:"auto_continue"`
+		MaxContinuations   int                         `json:"max_continuations"`
+		Network            Network                     `json:"network"`
+	}
+	if err := json.Unmarshal(data, &profileData); err != nil {
+		return fmt.Errorf("parsing profile %s: %w", y.profileFile, err)
+	}
+	y.profileContents = string(data)
+	var problems []error
+	if profileData.Model != "" {
+		y.model = profileData.Model
+	}
+	if profileData.Provider != "" {
+		y.currentProvider = profileData.Provider
+	}
+	y.checkKeysOnStartup = profileData.CheckKeysOnStartup
+	y.storageBackend = profileData.Storage
+	y.providerSettings = profileData.Providers
+	y.autoContinue = profileData.AutoContinue
+	y.maxContinuations = DefaultMaxContinuations
+	if profileData.MaxContinuations > 0 {
+		y.maxContinuations = profileData.MaxContinuations
+	}
+	problems = append(problems, y.applyProviderSettings()...)
+	y.profileNetwork = profileData.Network
+	if profileData.Network != y.network {
+		if err := y.SetNetwork(profileData.Network); err != nil {
+			problems = append(problems, fmt.Errorf("network: %w", err))
+		}
+	}
+	if profileData.LogLevel != "" {
+		y.profileLogLevel = profileData.LogLevel
+		if err := y.SetLogLevel(profileData.LogLevel); err != nil {
+			problems = append(problems, err)
+		}
+	} else if y.profileLogLevel != "" {
+		// The level was taken out of the profile since it was last loaded.
+		y.profileLogLevel = ""
+		y.SetLogLevel("info")
+	}
+	if profileData.Persona != "" {
+		persona, err := y.loadPersona(profileData.Persona)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			y.persona = persona
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("profile %s: %w", y.profileFile, errors.Join(problems...))
+	}
+	y.logger.Debug("profile loaded", "provider", y.currentProvider, "model", y.model)
+	return nil
+}
+
+// providerSettings are the per-provider overrides in the "providers"
+// section of profile.json. Durations use Go syntax such as "90s" or "5m".
+type providerSettings struct {
+	Proxy            string `json:"proxy,omitempty"`
+	ConnectTimeout   string `json:"connect_timeout,omitempty"`
+	FirstByteTimeout string `json:"first_byte_timeout,omitempty"`
+	IdleTimeout      string `json:"idle_timeout,omitempty"`
+}
+
+// applyProviderSettings sets every provider back to the defaults and then
+// applies the overrides from profile.json, returning those it had to skip.
+func (y *YuzuChat) applyProviderSettings() []error {
+	var problems []error
+	for _, provider := range y.providers {
+		provider.Timeouts = DefaultTimeouts
+		provider.Proxy = ""
+	}
+	for name, settings := range y.providerSettings {
+		provider, exists := y.providers[name]
+		if !exists {
+			problems = append(problems, fmt.Errorf("provider '%s' %w", name, ErrNotFound))
+			continue
+		}
+		if settings.Proxy != "" {
+			if _, err := parseProxy(settings.Proxy); err != nil {
+				problems = append(problems, fmt.Errorf("%s %w", name, err))
+			} else {
+				provider.Proxy = settings.Proxy
+			}
+		}
+		for _, field := range []struct {
+			name   string
+			value  string
+			target *time.Duration
+		}{
+			{"connect_timeout", settings.ConnectTimeout, &provider.Timeouts.Connect},
+			{"first_byte_timeout", settings.FirstByteTimeout, &provider.Timeouts.FirstByte},
+			{"idle_timeout", settings.IdleTimeout, &provider.Timeouts.Idle},
+		} {
+			if field.value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(field.value)
+			if err != nil || duration < 0 {
+				problems = append(problems, fmt.Errorf("%s %s '%s' is not a duration like \"90s\"", name, field.name, field.value))
+				continue
+			}
+			*field.target = duration
+		}
+	}
+	return problems
+}
+
+// saveProfile writes the settings that outlive a session to profile.json.
+func (y *YuzuChat) saveProfile() error {
+	profileData := struct {
+		Model              string                      `json:"model"`
+		Provider           string                      `json:"provider"`
+		CheckKeysOnStartup bool                        `json:"check_keys_on_startup"`
+		Storage            string                      `json:"storage,omitempty"`
+		Persona            string                      `json:"persona,omitempty"`
+		LogLevel           string                      `json:"log_level,omitempty"`
+		Providers          map[string]providerSettings `json:"providers,omitempty"`
+		AutoContinue       bool                        `json:"auto_continue,omitempty"`
+		MaxContinuations   int                         `json:"max_continuations,omitempty"`
+		Network            *Network                    `json:"network,omitempty"`
+		LastUpdated        string                      `json:"last_updated"`
+	}{
+		Model:              y.model,
+		Provider:           y.currentProvider,
+		CheckKeysOnStartup: y.checkKeysOnStartup,
+		Storage:            y.storageBackend,
+		Persona:            y.PersonaName(),
+		LogLevel:           y.profileLogLevel,
+		Providers:          y.providerSettings,
+		AutoContinue:       y.autoContinue,
+		MaxContinuations:   y.profileMaxContinuations(),
+		LastUpdated:        time.Now().Format(time.RFC3339),
+	}
+	if y.profileNetwork != (Network{}) {
+		profileData.Network = &y.profileNetwork
+	}
+	data, err := json.MarshalIndent(profileData, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(y.profileFile, data, 0644, true)
+	}
+	if err != nil {
+		y.logger.Error("saving profile", "path", y.profileFile, "error", err.Error())
+		return fmt.Errorf("%w: profile: %w", ErrStorage, err)
+	}
+	y.profileContents = string(data)
+	return nil
+}
+
+// Close stops watching config files and releases the storage, connections,
+// lock and log of the client.
+func (y *YuzuChat) Close() error {
+	if y.stopWatching != nil {
+		y.stopWatching()
+	}
+	err := y.store.Close()
+	if err != nil {
+		y.logger.Error("closing storage", "error", err.Error())
+	}
+	y.pool.CloseIdleConnections()
+	y.releaseInstanceLock()
+	y.closeLog()
+	return err
+}
+
+// ProviderNames returns every provider, with or without a key, sorted.
+func (y *YuzuChat) ProviderNames() []string {
+	names := make([]string, 0, len(y.providers))
+	for name := range y.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (y *YuzuChat) ListProviders() []string {
+	var providers []string
+	for name, provider := range y.providers {
+		if provider.IsEnabled {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+func (y *YuzuChat) ListModels() []string {
+	if provider, exists := y.providers[y.currentProvider]; exists {
+		return provider.Models
+	}
+	return []string{}
+}
+
+// ChangeProvider switches to providerName and its first model.
+func (y *YuzuChat) ChangeProvider(providerName string) error {
+	provider, exists := y.providers[providerName]
+	if !exists {
+		return fmt.Errorf("provider '%s' %w", providerName, ErrNotFound)
+	}
+	if !provider.IsEnabled {
+		return &ProviderError{Kind: ErrProviderUnavailable, Provider: providerName, Message: "no API key in " + provider.KeyFile}
+	}
+	y.currentProvider = providerName
+	if len(provider.Models) > 0 {
+		y.model = provider.Models[0]
+	}
+	return y.saveProfile()
+}
+
+// ChangeModel switches to the first model of the current provider whose name
+// contains modelName and returns its full name.
+func (y *YuzuChat) ChangeModel(modelName string) (string, error) {
+	availableModel, ok := y.findModel(modelName)
+	if !ok {
+		return "", fmt.Errorf("model '%s' %w for %s", modelName, ErrNotFound, y.currentProvider)
+	}
+	y.model = availableModel
+	return availableModel, y.saveProfile()
+}
+
+// findModel returns the first model of the current provider whose name
+// contains modelName, ignoring case.
+func (y *YuzuChat) findModel(modelName string) (string, bool) {
+	if provider, exists := y.providers[y.currentProvider]; exists {
+		return findModelIn(provider, modelName)
+	}
+	return "", false
+}
+
+func findModelIn(provider *AIProvider, modelName string) (string, bool) {
+	modelNameLower := strings.ToLower(modelName)
+	for _, availableModel := range provider.Models {
+		if strings.Contains(strings.ToLower(availableModel), modelNameLower) {
+			return availableModel, true
+		}
+	}
+	return "", false
+}
+
+// CurrentProvider returns the name of the provider requests go to.
+func (y *YuzuChat) CurrentProvider() string {
+	return y.currentProvider
+}
+
+// CurrentModel returns the model requests use.
+func (y *YuzuChat) CurrentModel() string {
+	return y.model
+}
+
+// Provider looks up a provider by name.
+func (y *YuzuChat) Provider(name string) (*AIProvider, bool) {
+	provider, exists := y.providers[name]
+	return provider, exists
+}
+
+// SetBaseURL points a provider at another OpenAI-compatible API root such as
+// "http://localhost:8000/v1", for local servers and tests. Chat requests go
+// to baseURL/chat/completions and key checks to the same path under it as
+// before.
+func (y *YuzuChat) SetBaseURL(providerName, baseURL string) error {
+	provider, exists := y.providers[providerName]
+	if !exists {
+		return fmt.Errorf("provider '%s' %w", providerName, ErrNotFound)
+	}
+	root := strings.TrimSuffix(provider.BaseURL, "/chat/completions")
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if checkPath, found := strings.CutPrefix(provider.CheckURL, root); found {
+		provider.CheckURL = baseURL + checkPath
+	}
+	provider.BaseURL = baseURL + "/chat/completions"
+	return nil
+}
+
+// SetTransport sends all provider traffic through rt, as Record and Replay
+// do. nil restores the default transport.
+func (y *YuzuChat) SetTransport(rt http.RoundTripper) {
+	y.transport = rt
+}
+
+// History returns the messages of the current conversation window.
+func (y *YuzuChat) History() []Message {
+	return y.conversationHistory
+}
+
+// SessionID identifies the current conversation in the archive.
+func (y *YuzuChat) SessionID() string {
+	return y.sessionID
+}
+
+// Info summarises the client's state for status displays.
+type Info struct {
+	Provider         string
+	KeyFile          string
+	Model            string
+	Persona          string // "" when none is active
+	JSONMode         bool
+	AutoContinue     bool
+	SystemLines      int
+	Messages         int
+	EnabledProviders int
+	Providers        int
+	ContextChars     int
+}
+
+// Info returns the current provider, model, settings and conversation size.
+func (y *YuzuChat) Info() Info {
+	info := Info{
+		Provider:     y.currentProvider,
+		Model:        y.model,
+		Persona:      y.PersonaName(),
+		JSONMode:     y.jsonMode,
+		AutoContinue: y.autoContinue,
+		Messages:     len(y.conversationHistory),
+		Providers:    len(y.providers),
+	}
+	if provider, exists := y.providers[y.currentProvider]; exists {
+		info.KeyFile = provider.KeyFile
+	}
+	for _, msg := range y.conversationHistory {
+		info.ContextChars += len(msg.Content)
+	}
+	for _, provider := range y.providers {
+		if provider.IsEnabled {
+			info.EnabledProviders++
+		}
+	}
+	if y.systemPrompt != "" {
+		info.SystemLines = strings.Count(y.systemPrompt, "\n") + 1
+	}
+	return info
+}
+
+// SplitArgs splits a command line on whitespace, keeping "quoted phrases"
+// together.
+func SplitArgs(input string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	hasArg := false
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case unicode.IsSpace(r) && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
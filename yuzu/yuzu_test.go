@@ -0,0 +1,202 @@
+package yuzu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/icedeyes12/yuzuchat/internal/fakeprovider"
+)
+
+// openChat loads a client from the state files in dir with every provider
+// pointed at fake.
+func openChat(t *testing.T, dir string, fake *fakeprovider.Server) *YuzuChat {
+	t.Helper()
+	chat, err := New(filepath.Join(dir, "chat_history.json"), filepath.Join(dir, "profile.json"), filepath.Join(dir, "system.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range chat.providers {
+		if err := chat.SetBaseURL(name, fake.BaseURL()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chat
+}
+
+// newTestChat runs the test in a fresh directory holding a chutes key and
+// returns a client talking to fake.
+func newTestChat(t *testing.T, fake *fakeprovider.Server) *YuzuChat {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	chat := openChat(t, dir, fake)
+	t.Cleanup(func() { chat.Close() })
+	return chat
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileRoundTrip(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "cu.key", "test-key")
+	writeFile(t, "or.key", "test-key")
+
+	chat := openChat(t, dir, fake)
+	if err := chat.ChangeProvider("openrouter"); err != nil {
+		t.Fatal(err)
+	}
+	model, err := chat.ChangeModel("qwen3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.SetKeyCheckOnStartup(false); err != nil {
+		t.Fatal(err)
+	}
+	chat.Close()
+
+	reopened := openChat(t, dir, fake)
+	defer reopened.Close()
+	if reopened.CurrentProvider() != "openrouter" || reopened.CurrentModel() != model {
+		t.Errorf("reloaded %s/%s, want openrouter/%s", reopened.CurrentProvider(), reopened.CurrentModel(), model)
+	}
+	if _, err := os.Stat("profile.json.bak"); err != nil {
+		t.Errorf("previous profile not backed up: %v", err)
+	}
+}
+
+func TestChangeProviderErrors(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if err := chat.ChangeProvider("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown provider: got %v, want ErrNotFound", err)
+	}
+	if err := chat.ChangeProvider("cerebras"); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("provider without key: got %v, want ErrProviderUnavailable", err)
+	}
+	if _, err := chat.ChangeModel("no-such-model"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown model: got %v, want ErrNotFound", err)
+	}
+	if chat.CurrentProvider() != "chutes" {
+		t.Errorf("provider changed to %s after errors", chat.CurrentProvider())
+	}
+}
+
+func TestSetBaseURL(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	if err := chat.SetBaseURL("openrouter", "http://localhost:9000/api/v1/"); err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := chat.Provider("openrouter")
+	if provider.BaseURL != "http://localhost:9000/api/v1/chat/completions" {
+		t.Errorf("BaseURL = %s", provider.BaseURL)
+	}
+	if provider.CheckURL != "http://localhost:9000/api/v1/key" {
+		t.Errorf("CheckURL = %s", provider.CheckURL)
+	}
+	if err := chat.SetBaseURL("nope", "http://localhost"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown provider: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"one two", []string{"one", "two"}},
+		{`  spaced   out  `, []string{"spaced", "out"}},
+		{`topic="black holes" level=easy`, []string{"topic=black holes", "level=easy"}},
+		{`""`, []string{""}},
+	}
+	for _, tt := range tests {
+		if got := SplitArgs(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	chat := newTestChat(t, fakeprovider.New(t))
+	info := chat.Info()
+	if info.Provider != "chutes" || info.KeyFile != "cu.key" || info.EnabledProviders != 1 || info.Providers != 3 || info.JSONMode {
+		t.Errorf("Info() = %+v", info)
+	}
+}
+
+func TestNewFailsOnBadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		want    string
+		storage bool
+	}{
+		{name: "unparsable profile", setup: func(t *testing.T) { writeFile(t, "profile.json", `{"model": 3}`) }, want: "parsing profile"},
+		{name: "bad provider proxy", setup: func(t *testing.T) {
+			writeFile(t, "profile.json", `{"providers": {"cerebras": {"proxy": "ftp://nope"}}}`)
+		}, want: "cerebras proxy 'ftp://nope'"},
+		{name: "bad timeout", setup: func(t *testing.T) {
+			writeFile(t, "profile.json", `{"providers": {"cerebras": {"first_byte_timeout": "soon"}}}`)
+		}, want: `first_byte_timeout 'soon' is not a duration`},
+		{name: "unknown provider", setup: func(t *testing.T) {
+			writeFile(t, "profile.json", `{"providers": {"nope": {"idle_timeout": "5m"}}}`)
+		}, want: "provider 'nope' not found"},
+		{name: "missing persona", setup: func(t *testing.T) { writeFile(t, "profile.json", `{"persona": "ghost"}`) }, want: "ghost"},
+		{name: "unopenable database", setup: func(t *testing.T) {
+			if err := os.Mkdir("yuzuchat.db", 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, want: "yuzuchat.db", storage: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			tt.setup(t)
+			chat, err := New(filepath.Join(dir, "chat_history.json"), filepath.Join(dir, "profile.json"), filepath.Join(dir, "system.txt"))
+			if err == nil {
+				chat.Close()
+				t.Fatal("New succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q lacks %q", err, tt.want)
+			}
+			if errors.Is(err, ErrStorage) != tt.storage {
+				t.Errorf("errors.Is(%v, ErrStorage) = %v", err, !tt.storage)
+			}
+		})
+	}
+}
+
+func TestSecondInstanceIsRefused(t *testing.T) {
+	fake := fakeprovider.New(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	chat := openChat(t, dir, fake)
+
+	second, err := New(filepath.Join(dir, "chat_history.json"), filepath.Join(dir, "profile.json"), filepath.Join(dir, "system.txt"))
+	if !errors.Is(err, ErrInUse) {
+		if second != nil {
+			second.Close()
+		}
+		t.Fatalf("second instance: got %v, want ErrInUse", err)
+	}
+	if !strings.Contains(err.Error(), "(PID ") {
+		t.Errorf("error %q does not name the holder", err)
+	}
+
+	chat.Close()
+	third := openChat(t, dir, fake)
+	third.Close()
+}